@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+
+	"go-playground/internal/wsctl"
+)
+
+// runClient implements `client`, a terminal websocket client. With no
+// further arguments it connects and streams stdin; `client notify` and
+// `client notify-redis` push notifications through the HTTP API.
+func runClient(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "notify":
+			return runClientNotify(args[1:])
+		case "notify-redis":
+			return runClientNotifyRedis(args[1:])
+		}
+	}
+
+	fs := flag.NewFlagSet("client", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "node address")
+	id := fs.String("id", "", "user id to connect as")
+	group := fs.String("group", "", "group to join")
+	topics := fs.String("topics", "", "comma-separated topics to subscribe to")
+	debug := fs.Bool("debug", false, "mark frames relayed through the backplane")
+	script := fs.String("script", "", "run a send/expect script from this file (- for stdin) instead of an interactive session")
+	_ = fs.Parse(args)
+	if *id == "" {
+		return errors.New("client: -id is required")
+	}
+
+	extra := url.Values{}
+	if *topics != "" {
+		extra.Set("topics", *topics)
+	}
+	if *debug {
+		extra.Set("debug", "1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	conn, err := wsctl.Dial(ctx, *addr, *id, *group, extra)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch *script {
+	case "":
+		return conn.Interactive(ctx, os.Stdin, os.Stdout)
+	case "-":
+		return conn.RunScript(os.Stdin, os.Stdout)
+	default:
+		file, err := os.Open(*script)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return conn.RunScript(file, os.Stdout)
+	}
+}
+
+func runClientNotify(args []string) error {
+	fs := flag.NewFlagSet("client notify", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "node address")
+	id := fs.String("id", "", "user id to notify")
+	message := fs.String("message", "notification", "message text")
+	_ = fs.Parse(args)
+	if *id == "" {
+		return errors.New("client notify: -id is required")
+	}
+	body, err := wsctl.NotifyUser(context.Background(), *addr, *id, *message)
+	if err != nil {
+		return err
+	}
+	fmt.Println(wsctl.Pretty(body))
+	return nil
+}
+
+func runClientNotifyRedis(args []string) error {
+	fs := flag.NewFlagSet("client notify-redis", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "node address")
+	ids := fs.String("ids", "", "comma-separated user ids to notify on every node")
+	message := fs.String("message", "redis notification", "message text")
+	_ = fs.Parse(args)
+	if strings.TrimSpace(*ids) == "" {
+		return errors.New("client notify-redis: -ids is required")
+	}
+	body, err := wsctl.NotifyRedis(context.Background(), *addr, strings.Split(*ids, ","), *message)
+	if err != nil {
+		return err
+	}
+	fmt.Println(wsctl.Pretty(body))
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// runHealthcheck probes a local endpoint and fails on anything but 200, so
+// distroless images can use it as their Docker HEALTHCHECK.
+func runHealthcheck(args []string) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	url := fs.String("url", fmt.Sprintf("http://127.0.0.1:%d/livez", defaultPort()), "endpoint to probe; PORT sets the default port")
+	timeout := fs.Duration("timeout", 2*time.Second, "request timeout")
+	_ = fs.Parse(args)
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(*url)
+	if err != nil {
+		return fmt.Errorf("healthcheck: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthcheck: %s returned %s", *url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+
+	"go-playground/internal/loadtest"
+)
+
+// runLoadtest implements `loadtest`, which drives websocket load at one or
+// more running nodes and prints a latency report.
+func runLoadtest(args []string) error {
+	cfg := loadtest.DefaultConfig()
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	urls := fs.String("urls", strings.Join(cfg.URLs, ","), "comma-separated websocket URLs to spread connections over")
+	fs.IntVar(&cfg.Connections, "conns", cfg.Connections, "number of websocket connections")
+	fs.IntVar(&cfg.Users, "users", cfg.Users, "number of distinct user ids")
+	fs.IntVar(&cfg.Groups, "groups", cfg.Groups, "number of distinct groups")
+	fs.Float64Var(&cfg.Rate, "rate", cfg.Rate, "frames per second across all connections")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "how long to send after ramp-up")
+	fs.DurationVar(&cfg.RampUp, "ramp", cfg.RampUp, "window over which connections are opened")
+	fs.IntVar(&cfg.PayloadSize, "size", cfg.PayloadSize, "approximate frame size in bytes")
+	fs.BoolVar(&cfg.Reconnect, "reconnect", cfg.Reconnect, "re-dial dropped connections")
+	fs.DurationVar(&cfg.ReconnectDelay, "reconnect-delay", cfg.ReconnectDelay, "delay before re-dialing")
+	fs.DurationVar(&cfg.Drain, "drain", cfg.Drain, "wait for in-flight frames after sending stops")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	_ = fs.Parse(args)
+
+	cfg.URLs = nil
+	for _, raw := range strings.Split(*urls, ",") {
+		if raw = strings.TrimSpace(raw); raw != "" {
+			cfg.URLs = append(cfg.URLs, raw)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := loadtest.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.WriteText(os.Stdout)
+}
@@ -1,15 +1,63 @@
 package main
 
 import (
-	"flag"
-
-	"go-playground/internal/app"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
+// command is one subcommand of the binary.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":       {"run the HTTP and websocket server (default)", runServe},
+	"config":      {"config check: validate configuration and backplane connectivity", runConfig},
+	"version":     {"print build information", runVersion},
+	"gen-assets":  {"regenerate web UI, compose and helper-script files", runGenAssets},
+	"healthcheck": {"probe a running server; for containers without curl", runHealthcheck},
+	"loadtest":    {"drive websocket load at one or more nodes", runLoadtest},
+	"client":      {"terminal websocket client and notify wrappers", runClient},
+}
+
 func main() {
-	// Allow running multiple nodes locally by passing a port per process.
-	port := flag.Int("port", 8080, "http server port")
-	flag.Parse()
+	args := os.Args[1:]
+	// Bare flags keep the old `app -port 8081` invocation working.
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+}
 
-	app.Run(*port)
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+
+	"go-playground/internal/app"
+	"go-playground/internal/assets"
+)
+
+// serveFlags registers the flags shared by serve and config check.
+func serveFlags(fs *flag.FlagSet) *app.Config {
+	cfg := &app.Config{}
+	// Allow running multiple nodes locally by passing a port per process.
+	fs.IntVar(&cfg.Port, "port", defaultPort(), "http server port; PORT sets the default")
+	// Local nodes can share an in-process broker instead of a Redis container.
+	fs.StringVar(&cfg.Backplane, "backplane", app.BackplaneRedis, "backplane: redis, memory or embedded")
+	fs.StringVar(&cfg.BrokerAddr, "broker", app.DefaultBrokerAddr, "embedded broker address shared by local nodes")
+	fs.DurationVar(&cfg.DrainGrace, "drain-grace", app.DefaultDrainGrace, "how long to report not-ready before shutting down")
+	fs.BoolVar(&cfg.UI, "ui", false, "serve the embedded test UI at /ui")
+	return cfg
+}
+
+// defaultPort is the -port default: PORT when set, else 8080. healthcheck
+// uses it too, so a container started with PORT probes the port it serves.
+func defaultPort() int {
+	if port, err := strconv.Atoi(os.Getenv("PORT")); err == nil && port > 0 {
+		return port
+	}
+	return 8080
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg := serveFlags(fs)
+	_ = fs.Parse(args)
+	app.Run(*cfg)
+	return nil
+}
+
+// runConfig implements `config check`.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check [serve flags]")
+	}
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	cfg := serveFlags(fs)
+	_ = fs.Parse(args[1:])
+	return app.Check(context.Background(), *cfg, os.Stdout)
+}
+
+func runGenAssets(args []string) error {
+	return assets.Command("gen-assets", args, os.Stdout)
+}
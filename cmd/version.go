@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)" ./cmd
+//
+// Unset values fall back to the VCS stamp the go tool embeds.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+func runVersion([]string) error {
+	rev, when := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && rev == "":
+				rev = setting.Value
+			case setting.Key == "vcs.time" && when == "":
+				when = setting.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if when == "" {
+		when = "unknown"
+	}
+	fmt.Printf("version %s\ncommit  %s\nbuilt   %s\ngo      %s %s/%s\n",
+		version, rev, when, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -1,16 +1,107 @@
 package app
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"go-playground/internal/httpserver"
+	"go-playground/internal/schema"
+	"go-playground/internal/webhook"
+	"go-playground/internal/ws"
 )
 
-// Run wires up the HTTP server and starts it on the given port.
-func Run(port int) {
-	server := httpserver.New()
+// DefaultDrainGrace is how long a stopping node reports not-ready before
+// it stops accepting requests.
+const DefaultDrainGrace = 5 * time.Second
 
-	if err := server.Run(port); err != nil {
+// Config carries the process-level settings from the command line.
+type Config struct {
+	Port int
+	// Backplane is redis, memory or embedded.
+	Backplane string
+	// BrokerAddr is the shared broker address in embedded mode.
+	BrokerAddr string
+	// DrainGrace is the shutdown window after SIGTERM; see DefaultDrainGrace.
+	DrainGrace time.Duration
+	// UI serves the embedded test UI at /ui.
+	UI bool
+}
+
+// Run wires up the HTTP server and starts it on the configured port. On
+// SIGINT or SIGTERM the node drains before shutting down.
+func Run(cfg Config) {
+	opts, closeBroker, err := backplane(cfg)
+	if err != nil {
+		log.Fatalf("backplane setup failed: %v", err)
+	}
+	defer closeBroker()
+
+	hooks, closeWebhooks, err := webhooks()
+	if err != nil {
+		log.Fatalf("webhook setup failed: %v", err)
+	}
+	defer closeWebhooks()
+	opts = append(opts, hooks...)
+
+	if path := os.Getenv("GROUP_ACL_FILE"); path != "" {
+		acl, err := ws.LoadACL(path)
+		if err != nil {
+			log.Fatalf("group acl setup failed: %v", err)
+		}
+		log.Printf("group acl: %d policies from %s", len(acl.Policies()), path)
+		opts = append(opts, httpserver.WithHubOptions(ws.WithACL(acl)))
+	}
+
+	if dir := os.Getenv("SCHEMA_DIR"); dir != "" {
+		schemas, err := schema.LoadDir(dir)
+		if err != nil {
+			log.Fatalf("message schemas invalid: %v", err)
+		}
+		log.Printf("message schemas: %d type(s) from %s", len(schemas), dir)
+		opts = append(opts, httpserver.WithHubOptions(ws.WithSchemas(schemas)))
+	}
+
+	limits, err := ws.LimitsFromEnv()
+	if err != nil {
+		log.Fatalf("connection limits invalid: %v", err)
+	}
+	opts = append(opts, httpserver.WithHubOptions(ws.WithLimits(limits)))
+
+	if cfg.UI {
+		opts = append(opts, httpserver.WithUI())
+	}
+	server := httpserver.New(opts...)
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Serve(ctx, cfg.Port, cfg.DrainGrace); err != nil {
 		log.Fatalf("server stopped with error: %v", err)
 	}
+	log.Printf("server drained and stopped")
+}
+
+// webhooks starts event forwarding when WEBHOOK_URLS is set. The returned
+// closer flushes queued events before the process exits.
+func webhooks() ([]httpserver.Option, func(), error) {
+	cfg, closeDeadLetter, err := webhook.ConfigFromEnv()
+	if err != nil || len(cfg.URLs) == 0 {
+		_ = closeDeadLetter()
+		return nil, func() {}, err
+	}
+	forwarder, err := webhook.New(cfg)
+	if err != nil {
+		_ = closeDeadLetter()
+		return nil, func() {}, err
+	}
+	log.Printf("webhooks: forwarding to %d url(s)", len(cfg.URLs))
+	closer := func() {
+		forwarder.Close()
+		_ = closeDeadLetter()
+	}
+	return []httpserver.Option{httpserver.WithHubOptions(forwarder.HubOptions()...)}, closer, nil
 }
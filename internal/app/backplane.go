@@ -0,0 +1,128 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+	"time"
+
+	"go-playground/internal/httpserver"
+	"go-playground/internal/memredis"
+	"go-playground/internal/ws"
+)
+
+// Backplane modes selectable with -backplane.
+const (
+	// BackplaneRedis uses the external Redis described by REDIS_* variables.
+	BackplaneRedis = "redis"
+	// BackplaneMemory runs a private in-process broker, handy for a single
+	// node that still wants receipts and inboxes without Docker.
+	BackplaneMemory = "memory"
+	// BackplaneEmbedded shares one in-process broker between local nodes:
+	// the first node to bind the broker address hosts it, the rest connect
+	// and one of them re-hosts it if that node exits.
+	BackplaneEmbedded = "embedded"
+)
+
+// DefaultBrokerAddr is where embedded-mode nodes meet.
+const DefaultBrokerAddr = "127.0.0.1:6390"
+
+// brokerStandbyInterval is how often a joined node checks whether the
+// embedded broker's host has exited so it can take over.
+const brokerStandbyInterval = time.Second
+
+// backplane resolves the hub options for the chosen mode. The returned
+// closer stops a broker hosted by this process.
+func backplane(cfg Config) ([]httpserver.Option, func(), error) {
+	noop := func() {}
+	switch cfg.Backplane {
+	case "", BackplaneRedis:
+		return nil, noop, nil
+	case BackplaneMemory:
+		broker := memredis.New()
+		if err := broker.Start("127.0.0.1:0"); err != nil {
+			return nil, noop, fmt.Errorf("start memory broker: %w", err)
+		}
+		opts, err := brokerOptions(broker.Addr())
+		if err != nil {
+			_ = broker.Close()
+			return nil, noop, err
+		}
+		log.Printf("backplane: private in-memory broker at %s", broker.Addr())
+		return opts, func() { _ = broker.Close() }, nil
+	case BackplaneEmbedded:
+		addr := cfg.BrokerAddr
+		if addr == "" {
+			addr = DefaultBrokerAddr
+		}
+		opts, err := brokerOptions(addr)
+		if err != nil {
+			return nil, noop, err
+		}
+		broker := memredis.New()
+		err = broker.Start(addr)
+		switch {
+		case err == nil:
+			log.Printf("backplane: hosting embedded broker at %s", addr)
+			return opts, func() { _ = broker.Close() }, nil
+		case errors.Is(err, syscall.EADDRINUSE):
+			// Another local node already hosts the broker; join it and stand
+			// by to host it if that node exits.
+			log.Printf("backplane: joining embedded broker at %s", addr)
+			stop, done := make(chan struct{}), make(chan struct{})
+			go standby(broker, addr, stop, done)
+			return opts, func() {
+				close(stop)
+				<-done
+				_ = broker.Close()
+			}, nil
+		default:
+			return nil, noop, fmt.Errorf("start embedded broker: %w", err)
+		}
+	default:
+		return nil, noop, fmt.Errorf("unknown backplane %q (want %s, %s or %s)", cfg.Backplane, BackplaneRedis, BackplaneMemory, BackplaneEmbedded)
+	}
+}
+
+// standby takes over the embedded broker address once its host exits, so
+// the remaining nodes keep a backplane. The new broker starts empty; hub
+// clients reconnect and resubscribe on their own.
+func standby(broker *memredis.Server, addr string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(brokerStandbyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := broker.Start(addr)
+		if err == nil {
+			log.Printf("backplane: embedded broker host exited, now hosting at %s", addr)
+			return
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			log.Printf("backplane: take over embedded broker at %s failed: %v", addr, err)
+		}
+	}
+}
+
+// brokerOptions points the hub at a local broker.
+func brokerOptions(addr string) ([]httpserver.Option, error) {
+	cfg, err := brokerConfig(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []httpserver.Option{httpserver.WithHubOptions(ws.WithRedisConfig(cfg))}, nil
+}
+
+// brokerConfig keeps REDIS_CHANNEL but connects to the local broker.
+func brokerConfig(addr string) (ws.RedisConfig, error) {
+	env, err := ws.RedisConfigFromEnv()
+	if err != nil {
+		return ws.RedisConfig{}, fmt.Errorf("backplane: %w", err)
+	}
+	return ws.RedisConfig{Mode: ws.RedisModeSingle, Addrs: []string{addr}, Channel: env.Channel}, nil
+}
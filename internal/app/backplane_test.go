@@ -0,0 +1,98 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-playground/internal/httpserver"
+)
+
+// serveReadyz starts a node with opts and returns a probe of its /readyz.
+func serveReadyz(t *testing.T, opts []httpserver.Option) func() int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := httpserver.New(opts...)
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		server.Close()
+	})
+	return func() int {
+		resp, err := http.Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("GET /readyz: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+}
+
+// waitReady polls readyz until it answers 200.
+func waitReady(t *testing.T, readyz func() int, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for readyz() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatalf("node not ready: %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMemoryBackplane(t *testing.T) {
+	t.Setenv("REDIS_CHANNEL", "test:broadcast")
+	cfg, err := brokerConfig("127.0.0.1:1")
+	if err != nil || cfg.Channel != "test:broadcast" {
+		t.Fatalf("broker config = %+v, %v; want REDIS_CHANNEL applied", cfg, err)
+	}
+
+	opts, closeBroker, err := backplane(Config{Backplane: BackplaneMemory})
+	if err != nil {
+		t.Fatalf("memory backplane: %v", err)
+	}
+	t.Cleanup(closeBroker)
+	waitReady(t, serveReadyz(t, opts), "private broker")
+}
+
+func TestEmbeddedBackplaneFailover(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve address: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	cfg := Config{Backplane: BackplaneEmbedded, BrokerAddr: addr}
+	_, closeHost, err := backplane(cfg)
+	if err != nil {
+		t.Fatalf("hosting node: %v", err)
+	}
+	opts, closeJoined, err := backplane(cfg)
+	if err != nil {
+		t.Fatalf("joining node: %v", err)
+	}
+	t.Cleanup(closeJoined)
+	readyz := serveReadyz(t, opts)
+	waitReady(t, readyz, "joined broker")
+
+	// Once the host exits, the joined node takes the address over.
+	closeHost()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no node re-hosted the broker at %s", addr)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	waitReady(t, readyz, "re-hosted broker")
+}
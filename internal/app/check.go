@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"go-playground/internal/schema"
+	"go-playground/internal/webhook"
+	"go-playground/internal/ws"
+)
+
+// checkTimeout bounds each connectivity probe in Check.
+const checkTimeout = 3 * time.Second
+
+// Check validates cfg and the environment the hub reads, then probes the
+// backplane. Each check is reported on its own line; the returned error
+// summarises failures so callers can exit non-zero.
+func Check(ctx context.Context, cfg Config, out io.Writer) error {
+	failed := 0
+	report := func(name string, err error, detail string) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %-12s %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(out, "ok   %-12s %s\n", name, detail)
+	}
+
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		report("port", fmt.Errorf("invalid port %d", cfg.Port), "")
+	} else {
+		report("port", nil, strconv.Itoa(cfg.Port))
+	}
+	report("receipts", checkEnvDuration("NOTIFY_RECEIPT_TTL"), "ttl "+envOr("NOTIFY_RECEIPT_TTL", "default"))
+	report("inbox", checkInboxEnv(), "enabled "+envOr("INBOX_ENABLED", "false"))
+	report("history", checkHistoryEnv(), "enabled "+envOr("HISTORY_ENABLED", "false"))
+
+	if hookCfg, err := webhook.CheckEnv(); err != nil {
+		report("webhooks", err, "")
+	} else {
+		report("webhooks", nil, strconv.Itoa(len(hookCfg.URLs))+" url(s)")
+	}
+
+	if path := os.Getenv("GROUP_ACL_FILE"); path != "" {
+		if acl, err := ws.LoadACL(path); err != nil {
+			report("group acl", err, "")
+		} else {
+			report("group acl", nil, strconv.Itoa(len(acl.Policies()))+" policies")
+		}
+	} else {
+		report("group acl", nil, "none")
+	}
+
+	if dir := os.Getenv("SCHEMA_DIR"); dir != "" {
+		if schemas, err := schema.LoadDir(dir); err != nil {
+			report("schemas", err, "")
+		} else {
+			report("schemas", nil, strconv.Itoa(len(schemas))+" type(s)")
+		}
+	} else {
+		report("schemas", nil, "none")
+	}
+
+	if limits, err := ws.LimitsFromEnv(); err != nil {
+		report("conn limits", err, "")
+	} else {
+		report("conn limits", nil, fmt.Sprintf("user %d, ip %d, cluster user %d, node %d (%s)", limits.PerUser, limits.PerIP, limits.ClusterPerUser, limits.Node, limits.Policy))
+	}
+
+	switch cfg.Backplane {
+	case "", BackplaneRedis:
+		redisCfg, err := ws.RedisConfigFromEnv()
+		if err != nil {
+			report("redis config", err, "")
+			break
+		}
+		report("redis config", nil, redisCfg.String())
+		report("redis", ping(ctx, redisCfg), "reachable")
+	case BackplaneMemory:
+		report("backplane", nil, "private in-memory broker")
+	case BackplaneEmbedded:
+		addr := cfg.BrokerAddr
+		if addr == "" {
+			addr = DefaultBrokerAddr
+		}
+		redisCfg := ws.RedisConfig{Mode: ws.RedisModeSingle, Addrs: []string{addr}}
+		if ping(ctx, redisCfg) == nil {
+			report("backplane", nil, "embedded broker running at "+addr+"; this node would join it")
+		} else {
+			report("backplane", nil, "no broker at "+addr+"; this node would host it")
+		}
+	default:
+		report("backplane", fmt.Errorf("unknown backplane %q (want %s, %s or %s)", cfg.Backplane, BackplaneRedis, BackplaneMemory, BackplaneEmbedded), "")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("config check: %d check(s) failed", failed)
+	}
+	return nil
+}
+
+// ping connects with cfg and issues a PING.
+func ping(ctx context.Context, cfg ws.RedisConfig) error {
+	client, err := cfg.NewClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	return client.Ping(ctx).Err()
+}
+
+// checkEnvDuration rejects values the hub would silently replace with its
+// default.
+func checkEnvDuration(name string) error {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(raw); err != nil || d <= 0 {
+		return fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return nil
+}
+
+func checkInboxEnv() error {
+	if raw := os.Getenv("INBOX_ENABLED"); raw != "" {
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return fmt.Errorf("invalid INBOX_ENABLED %q", raw)
+		}
+	}
+	if err := checkEnvDuration("INBOX_TTL"); err != nil {
+		return err
+	}
+	if raw := os.Getenv("INBOX_MAX"); raw != "" {
+		if n, err := strconv.Atoi(raw); err != nil || n <= 0 {
+			return fmt.Errorf("invalid INBOX_MAX %q", raw)
+		}
+	}
+	return nil
+}
+
+func checkHistoryEnv() error {
+	if raw := os.Getenv("HISTORY_ENABLED"); raw != "" {
+		if _, err := strconv.ParseBool(raw); err != nil {
+			return fmt.Errorf("invalid HISTORY_ENABLED %q", raw)
+		}
+	}
+	if raw := os.Getenv("HISTORY_MAX"); raw != "" {
+		if n, err := strconv.Atoi(raw); err != nil || n <= 0 {
+			return fmt.Errorf("invalid HISTORY_MAX %q", raw)
+		}
+	}
+	return nil
+}
+
+func envOr(name, fallback string) string {
+	if raw := os.Getenv(name); raw != "" {
+		return raw
+	}
+	return fallback
+}
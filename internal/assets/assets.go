@@ -0,0 +1,307 @@
+// Package assets renders the web UI, nginx, compose and helper-script files
+// that are generated into the repository, so they are defined in one place
+// instead of being edited by hand.
+//
+// Each file under templates/ is a text/template whose output path is its
+// name without the .tmpl suffix; Params fills in ports, hosts, Redis
+// settings and service names. Templates that render to nothing, such as the
+// proxy config without -proxy, produce no file.
+package assets
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// Params are the values substituted into the templates. The defaults
+// reproduce the committed files.
+type Params struct {
+	// Host is the default websocket host in the UI.
+	Host string
+	// NodePorts are the app ports offered by the UI's node picker.
+	NodePorts []int
+	// AppPort and WebPort are the host ports published by compose.
+	AppPort int
+	WebPort int
+	// RedisImage, RedisPort and RedisChannel configure the backplane service.
+	RedisImage   string
+	RedisPort    int
+	RedisChannel string
+	// Service names used in compose and the helper scripts.
+	AppService   string
+	WebService   string
+	RedisService string
+	// ComposeFile is the compose path the helper scripts pass to docker.
+	ComposeFile string
+	// Nodes is how many app services compose runs; with more than one they
+	// are named AppService-1..N on consecutive ports from AppPort.
+	Nodes int
+	// Proxy adds an nginx reverse proxy in front of the nodes: ProxySticky
+	// pins a client to one node, ProxyRoundRobin spreads connections.
+	Proxy        string
+	ProxyPort    int
+	ProxyService string
+}
+
+// Reverse proxy balancing modes for Params.Proxy.
+const (
+	ProxyNone       = ""
+	ProxySticky     = "sticky"
+	ProxyRoundRobin = "round-robin"
+)
+
+// App is one generated app service.
+type App struct {
+	Name string
+	Port int
+}
+
+// Apps lists the app services; templates range over it.
+func (p Params) Apps() []App {
+	if p.Nodes <= 1 {
+		return []App{{Name: p.AppService, Port: p.AppPort}}
+	}
+	apps := make([]App, p.Nodes)
+	for i := range apps {
+		apps[i] = App{Name: p.AppService + "-" + strconv.Itoa(i+1), Port: p.AppPort + i}
+	}
+	return apps
+}
+
+// Validate rejects parameters that would render a broken setup.
+func (p Params) Validate() error {
+	if p.Nodes < 1 {
+		return fmt.Errorf("nodes must be at least 1, got %d", p.Nodes)
+	}
+	switch p.Proxy {
+	case ProxyNone, ProxySticky, ProxyRoundRobin:
+	default:
+		return fmt.Errorf("unknown proxy mode %q (want %s or %s)", p.Proxy, ProxySticky, ProxyRoundRobin)
+	}
+	return nil
+}
+
+// DefaultParams returns the parameters the committed files are built from.
+func DefaultParams() Params {
+	return Params{
+		Host:         "localhost",
+		NodePorts:    []int{8080, 8081},
+		AppPort:      8080,
+		WebPort:      3000,
+		RedisImage:   "redis:7-alpine",
+		RedisPort:    6379,
+		RedisChannel: "ws:broadcast",
+		AppService:   "app",
+		WebService:   "web",
+		RedisService: "redis",
+		ComposeFile:  "docker/docker-compose.yml",
+		Nodes:        1,
+		ProxyPort:    8000,
+		ProxyService: "proxy",
+	}
+}
+
+// Render executes every template and returns the output keyed by
+// repository-relative path.
+func Render(p Params) (map[string][]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	err := fs.WalkDir(templates, "templates", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := templates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(path.Base(name)).Option("missingkey=error").Parse(string(raw))
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, p); err != nil {
+			return fmt.Errorf("render %s: %w", name, err)
+		}
+		if buf.Len() == 0 {
+			return nil
+		}
+		out := strings.TrimSuffix(strings.TrimPrefix(name, "templates/"), ".tmpl")
+		files[out] = buf.Bytes()
+		return nil
+	})
+	return files, err
+}
+
+// Write stores files under root and logs each path to log.
+func Write(root string, files map[string][]byte, log io.Writer) error {
+	for _, name := range sortedPaths(files) {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		// Ensure parent directories exist before writing each file.
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return fmt.Errorf("create dir %s: %w", name, err)
+		}
+		// Overwrite content so repeated runs stay deterministic.
+		if err := os.WriteFile(fullPath, files[name], 0o644); err != nil {
+			return fmt.Errorf("write file %s: %w", name, err)
+		}
+		fmt.Fprintf(log, "wrote %s\n", name)
+	}
+	return nil
+}
+
+// Check compares files with what is under root, describes each drifted
+// file on log and reports how many drifted.
+func Check(root string, files map[string][]byte, log io.Writer) (int, error) {
+	drifted := 0
+	for _, name := range sortedPaths(files) {
+		onDisk, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			drifted++
+			fmt.Fprintf(log, "missing %s\n", name)
+		case err != nil:
+			return drifted, err
+		case !bytes.Equal(onDisk, files[name]):
+			drifted++
+			fmt.Fprintf(log, "drift %s\n%s", name, firstDifference(onDisk, files[name]))
+		}
+	}
+	return drifted, nil
+}
+
+// firstDifference shows the first differing line, which is usually enough
+// to see which edit was made by hand.
+func firstDifference(disk, generated []byte) string {
+	diskLines := strings.Split(string(disk), "\n")
+	genLines := strings.Split(string(generated), "\n")
+	for i := 0; i < len(diskLines) || i < len(genLines); i++ {
+		var d, g string
+		if i < len(diskLines) {
+			d = diskLines[i]
+		}
+		if i < len(genLines) {
+			g = genLines[i]
+		}
+		if d != g || i >= len(diskLines) || i >= len(genLines) {
+			return fmt.Sprintf("  line %d\n  - disk:      %q\n  + generated: %q\n", i+1, d, g)
+		}
+	}
+	return ""
+}
+
+func sortedPaths(files map[string][]byte) []string {
+	paths := make([]string, 0, len(files))
+	for name := range files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ErrDrift is returned by Command when -check finds differences.
+var ErrDrift = errors.New("generated assets have drifted; run gen-assets")
+
+// Command implements the gen-assets command line shared by the binary and
+// scripts/gen_assets: it renders with flag-supplied params and writes to
+// -out, or with -check compares against -out and returns ErrDrift.
+func Command(name string, args []string, log io.Writer) error {
+	p := DefaultParams()
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	out := flags.String("out", ".", "directory to write into (or to compare with -check)")
+	check := flags.Bool("check", false, "compare generated output with -out and fail on drift")
+	ports := flags.String("node-ports", joinInts(p.NodePorts), "comma-separated app ports offered by the UI")
+	flags.StringVar(&p.Host, "host", p.Host, "default websocket host in the UI")
+	flags.IntVar(&p.AppPort, "app-port", p.AppPort, "host port published for the app")
+	flags.IntVar(&p.WebPort, "web-port", p.WebPort, "host port published for the web UI")
+	flags.StringVar(&p.RedisImage, "redis-image", p.RedisImage, "redis image")
+	flags.IntVar(&p.RedisPort, "redis-port", p.RedisPort, "host port published for redis")
+	flags.StringVar(&p.RedisChannel, "redis-channel", p.RedisChannel, "broadcast channel passed to the app")
+	flags.StringVar(&p.AppService, "app-service", p.AppService, "compose service name for the app")
+	flags.StringVar(&p.WebService, "web-service", p.WebService, "compose service name for the web UI")
+	flags.StringVar(&p.RedisService, "redis-service", p.RedisService, "compose service name for redis")
+	flags.StringVar(&p.ComposeFile, "compose-file", p.ComposeFile, "compose file path used by the helper scripts")
+	flags.IntVar(&p.Nodes, "nodes", p.Nodes, "number of app nodes in compose")
+	flags.StringVar(&p.Proxy, "proxy", p.Proxy, "reverse proxy in front of the nodes: sticky or round-robin (default none)")
+	flags.IntVar(&p.ProxyPort, "proxy-port", p.ProxyPort, "host port published for the proxy")
+	flags.StringVar(&p.ProxyService, "proxy-service", p.ProxyService, "compose service name for the proxy")
+	_ = flags.Parse(args)
+
+	var err error
+	if p.NodePorts, err = parseInts(*ports); err != nil {
+		return fmt.Errorf("invalid -node-ports: %w", err)
+	}
+	if !flagSet(flags, "node-ports") && (p.Nodes > 1 || p.Proxy != ProxyNone) {
+		// Offer the generated nodes (and the proxy first) in the UI picker.
+		p.NodePorts = nil
+		if p.Proxy != ProxyNone {
+			p.NodePorts = append(p.NodePorts, p.ProxyPort)
+		}
+		for _, app := range p.Apps() {
+			p.NodePorts = append(p.NodePorts, app.Port)
+		}
+	}
+	files, err := Render(p)
+	if err != nil {
+		return err
+	}
+	if !*check {
+		return Write(*out, files, log)
+	}
+	drifted, err := Check(*out, files, log)
+	if err != nil {
+		return err
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%w (%d file(s))", ErrDrift, drifted)
+	}
+	fmt.Fprintf(log, "%d files up to date\n", len(files))
+	return nil
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseInts(raw string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -0,0 +1,74 @@
+package assets
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestCommittedAssetsUpToDate fails when generated files were edited by
+// hand or a template changed without regenerating.
+func TestCommittedAssetsUpToDate(t *testing.T) {
+	files, err := Render(DefaultParams())
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var log strings.Builder
+	drifted, err := Check("../..", files, &log)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if drifted > 0 {
+		t.Fatalf("%d file(s) drifted; run go run ./cmd gen-assets\n%s", drifted, log.String())
+	}
+}
+
+func TestCheckReportsDrift(t *testing.T) {
+	dir := t.TempDir()
+	p := DefaultParams()
+	files, err := Render(p)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if err := Write(dir, files, io.Discard); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	p.WebPort = 3001
+	changed, err := Render(p)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var log strings.Builder
+	drifted, err := Check(dir, changed, &log)
+	if err != nil || drifted != 1 || !strings.Contains(log.String(), "docker/docker-compose.yml") {
+		t.Fatalf("drifted = %d, err = %v, log:\n%s", drifted, err, log.String())
+	}
+}
+
+func TestRenderNodesAndProxy(t *testing.T) {
+	p := DefaultParams()
+	p.Nodes = 3
+	p.Proxy = ProxySticky
+	files, err := Render(p)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	compose := string(files["docker/docker-compose.yml"])
+	for _, want := range []string{"app-1:", "app-3:", `"8082:8080"`, "proxy:"} {
+		if !strings.Contains(compose, want) {
+			t.Fatalf("compose missing %q:\n%s", want, compose)
+		}
+	}
+	if conf := string(files["docker/proxy.conf"]); !strings.Contains(conf, "ip_hash") || !strings.Contains(conf, "server app-3:8080") {
+		t.Fatalf("proxy.conf:\n%s", conf)
+	}
+
+	p.Proxy = "random"
+	if _, err := Render(p); err == nil {
+		t.Fatalf("unknown proxy mode accepted")
+	}
+	if files, _ := Render(DefaultParams()); files["docker/proxy.conf"] != nil {
+		t.Fatalf("proxy.conf generated without -proxy")
+	}
+}
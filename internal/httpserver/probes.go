@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probeTimeout bounds each individual probe check.
+const probeTimeout = time.Second
+
+// checkResult is the per-check detail in probe responses.
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// probe is a named check run by /livez or /readyz.
+type probe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// liveProbes are the checks that say the process is worth keeping alive. A
+// node whose backplane never connected is not: it would stay unready.
+func (s *Server) liveProbes() []probe {
+	return []probe{
+		{name: "hub", check: s.hub.Ping},
+		{name: "backplane_started", check: s.hub.BackplaneStarted},
+	}
+}
+
+// readyProbes additionally require the backplane, spare connection
+// capacity and that the node is not draining, so balancers stop routing to
+// degraded or full nodes.
+func (s *Server) readyProbes() []probe {
+	return append(s.liveProbes(),
+		probe{name: "backplane", check: s.hub.PingBackplane},
+		probe{name: "capacity", check: s.hub.AtCapacity},
+		probe{name: "draining", check: func(context.Context) error {
+			if s.hub.Draining() {
+				return errors.New("node is draining")
+			}
+			return nil
+		}},
+	)
+}
+
+// probeHandler runs the probes and answers 200 when all pass, 503 otherwise.
+func probeHandler(probes func() []probe) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, code := "ok", http.StatusOK
+		checks := make(map[string]checkResult)
+		for _, p := range probes() {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), probeTimeout)
+			start := time.Now()
+			err := p.check(ctx)
+			cancel()
+			result := checkResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+				status, code = "fail", http.StatusServiceUnavailable
+			}
+			checks[p.name] = result
+		}
+		c.JSON(code, gin.H{"status": status, "checks": checks})
+	}
+}
@@ -1,9 +1,14 @@
 package httpserver
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,11 +17,29 @@ import (
 
 // Server holds the Gin engine and configuration.
 type Server struct {
-	engine *gin.Engine
+	engine  *gin.Engine
+	hub     *ws.Hub
+	hubOpts []ws.Option
+	ui      bool
+}
+
+// Option customizes a Server at construction time.
+type Option func(*Server)
+
+// WithHubOptions passes options through to the websocket hub.
+func WithHubOptions(opts ...ws.Option) Option {
+	return func(s *Server) {
+		s.hubOpts = append(s.hubOpts, opts...)
+	}
 }
 
 // New constructs the HTTP server with routes and middleware.
-func New() *Server {
+func New(opts ...Option) *Server {
+	server := &Server{}
+	for _, opt := range opts {
+		opt(server)
+	}
+
 	engine := gin.New()
 	engine.Use(gin.Recovery())
 	engine.Use(gin.Logger())
@@ -24,8 +47,11 @@ func New() *Server {
 	engine.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+	// Liveness only checks the hub loop; readiness also needs the backplane.
+	engine.GET("/livez", probeHandler(server.liveProbes))
+	engine.GET("/readyz", probeHandler(server.readyProbes))
 
-	hub := ws.NewHub()
+	hub := ws.NewHub(server.hubOpts...)
 	go hub.Run()
 
 	engine.POST("/notify/user", func(c *gin.Context) {
@@ -54,30 +80,379 @@ func New() *Server {
 		if message == "" {
 			message = "redis notification"
 		}
-		parts := strings.Split(rawIDs, ",")
-		userIDs := make([]string, 0, len(parts))
-		for _, part := range parts {
-			id := strings.TrimSpace(part)
-			if id != "" {
-				userIDs = append(userIDs, id)
-			}
-		}
+		userIDs := splitList(rawIDs)
 		if len(userIDs) == 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "no valid ids"})
 			return
 		}
-		hub.PublishToUsers(userIDs, []byte(message))
-		c.JSON(http.StatusOK, gin.H{"status": "sent", "count": len(userIDs)})
+		id, err := hub.PublishToUsers(userIDs, []byte(message))
+		switch {
+		case errors.Is(err, ws.ErrMessageRejected):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "sent", "count": len(userIDs), "id": id})
+	})
+
+	v1 := engine.Group("/v1")
+	v1.GET("/notifications/:id", func(c *gin.Context) {
+		// Aggregate per-node delivery receipts stored in Redis.
+		status, err := hub.NotificationStatus(c.Request.Context(), c.Param("id"))
+		switch {
+		case errors.Is(err, ws.ErrNotificationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ws.ErrRedisUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	v1.GET("/inbox/:id", func(c *gin.Context) {
+		// Inspect notifications waiting for an offline user.
+		items, err := hub.InboxItems(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(inboxErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "count": len(items), "items": items})
+	})
+
+	v1.DELETE("/inbox/:id", func(c *gin.Context) {
+		purged, err := hub.PurgeInbox(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			c.JSON(inboxErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "purged": purged})
+	})
+
+	v1.POST("/users/:id/rpc", func(c *gin.Context) {
+		// Call a method on the user's client, wherever it is connected, and
+		// wait for its reply.
+		var body struct {
+			Method    string          `json:"method"`
+			Params    json.RawMessage `json:"params"`
+			TimeoutMS int             `json:"timeout_ms"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Method == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body must be JSON with a method"})
+			return
+		}
+		timeout := ws.DefaultCallTimeout
+		if body.TimeoutMS > 0 {
+			// Clamp before converting so huge values cannot overflow.
+			timeout = time.Duration(min(body.TimeoutMS, int(ws.MaxCallTimeout/time.Millisecond))) * time.Millisecond
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		result, err := hub.CallUser(ctx, c.Param("id"), body.Method, body.Params)
+		var rpcErr *ws.RPCError
+		switch {
+		case errors.Is(err, ws.ErrUserNotConnected):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ws.ErrCallTimeout):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+			return
+		case errors.As(err, &rpcErr):
+			// The client answered with an error of its own.
+			c.JSON(http.StatusBadGateway, gin.H{"error": rpcErr})
+			return
+		case err != nil:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "result": result})
+	})
+
+	// /acl lists the configured policies from GROUP_ACL_FILE. Edits under
+	// /groups/:group/acl are stored on the persisted group below, which
+	// every node loads, and take precedence over configuration.
+	v1.GET("/acl", func(c *gin.Context) {
+		c.JSON(http.StatusOK, hub.ACL().Policies())
+	})
+
+	v1.GET("/groups/:group/acl", func(c *gin.Context) {
+		policy, own := hub.ACL().Policy(c.Param("group"))
+		c.JSON(http.StatusOK, gin.H{"group": c.Param("group"), "policy": policy, "inherited": !own})
+	})
+
+	v1.PUT("/groups/:group/acl", func(c *gin.Context) {
+		var policy ws.GroupPolicy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := hub.SetGroupPolicy(c.Request.Context(), c.Param("group"), policy); err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"group": c.Param("group"), "policy": policy})
+	})
+
+	v1.DELETE("/groups/:group/acl", func(c *gin.Context) {
+		if err := hub.ClearGroupPolicy(c.Request.Context(), c.Param("group")); err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"group": c.Param("group"), "status": "deleted"})
+	})
+
+	// Persisted groups outlive their members being online; their members and
+	// policy feed the group ACL on every node.
+	v1.GET("/groups", func(c *gin.Context) {
+		groups, err := hub.ListGroups(c.Request.Context())
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(groups), "groups": groups})
+	})
+
+	v1.POST("/groups", func(c *gin.Context) {
+		var group ws.Group
+		if err := c.ShouldBindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		created, err := hub.CreateGroup(c.Request.Context(), group)
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, created)
+	})
+
+	v1.GET("/groups/:group", func(c *gin.Context) {
+		group, err := hub.GetGroup(c.Request.Context(), c.Param("group"))
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	})
+
+	v1.PUT("/groups/:group", func(c *gin.Context) {
+		var group ws.Group
+		if err := c.ShouldBindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		group.ID = c.Param("group")
+		updated, err := hub.UpdateGroup(c.Request.Context(), group)
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+
+	v1.DELETE("/groups/:group", func(c *gin.Context) {
+		if err := hub.DeleteGroup(c.Request.Context(), c.Param("group")); err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("group"), "status": "deleted"})
+	})
+
+	v1.PUT("/groups/:group/members/:user", func(c *gin.Context) {
+		group, err := hub.AddGroupMember(c.Request.Context(), c.Param("group"), c.Param("user"))
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	})
+
+	v1.DELETE("/groups/:group/members/:user", func(c *gin.Context) {
+		group, err := hub.RemoveGroupMember(c.Request.Context(), c.Param("group"), c.Param("user"))
+		if err != nil {
+			c.JSON(groupErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	})
+
+	groupMessages := func(c *gin.Context) {
+		// Page backwards through stored history with ?before=<id>&limit=<n>;
+		// next_before is set while older messages may remain.
+		limit := ws.DefaultHistoryPage
+		if raw := c.Query("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+		}
+		limit = min(limit, ws.MaxHistoryPage)
+		group := c.Param("group")
+		messages, err := hub.GroupMessages(c.Request.Context(), group, c.Query("before"), limit)
+		if err != nil {
+			c.JSON(historyErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		body := gin.H{"group": group, "count": len(messages), "messages": messages}
+		if len(messages) == limit {
+			body["next_before"] = messages[len(messages)-1].ID
+		}
+		c.JSON(http.StatusOK, body)
+	}
+	v1.GET("/groups/:group/messages", groupMessages)
+	// The history API was specified unversioned; keep that path as an alias.
+	engine.GET("/groups/:group/messages", groupMessages)
+
+	engine.POST("/notify/all", func(c *gin.Context) {
+		// Fan out to every connected client on every node.
+		message := c.Query("message")
+		if message == "" {
+			message = "broadcast"
+		}
+		hub.BroadcastAll([]byte(message))
+		c.JSON(http.StatusOK, gin.H{"status": "sent"})
+	})
+
+	engine.POST("/notify/groups", func(c *gin.Context) {
+		// Accept a comma-separated group list and send once per matching client.
+		groups := splitList(c.Query("groups"))
+		if len(groups) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing groups"})
+			return
+		}
+		message := c.Query("message")
+		if message == "" {
+			message = "group notification"
+		}
+		hub.SendToGroups(groups, []byte(message))
+		c.JSON(http.StatusOK, gin.H{"status": "sent", "count": len(groups)})
+	})
+
+	engine.POST("/notify/topic", func(c *gin.Context) {
+		// Match a wildcard pattern such as orders.* against client topic subscriptions.
+		pattern := strings.TrimSpace(c.Query("pattern"))
+		if pattern == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing pattern"})
+			return
+		}
+		message := c.Query("message")
+		if message == "" {
+			message = "topic notification"
+		}
+		hub.SendToTopic(pattern, []byte(message))
+		c.JSON(http.StatusOK, gin.H{"status": "sent"})
 	})
 
 	engine.GET("/ws", func(c *gin.Context) {
 		ws.HandleWebSocket(c.Writer, c.Request, hub)
 	})
 
-	return &Server{engine: engine}
+	if server.ui {
+		mountUI(engine)
+	}
+
+	server.engine = engine
+	server.hub = hub
+	return server
+}
+
+// Handler exposes the routes for embedding, e.g. in httptest servers.
+func (s *Server) Handler() http.Handler {
+	return s.engine
+}
+
+// Hub returns the websocket hub behind the routes.
+func (s *Server) Hub() *ws.Hub {
+	return s.hub
+}
+
+// Close stops the hub and releases its backplane connections.
+func (s *Server) Close() {
+	s.hub.Close()
+}
+
+// Drain fails readiness so balancers stop routing here before shutdown.
+func (s *Server) Drain() {
+	s.hub.Drain()
 }
 
 // Run starts the Gin server on the provided port.
 func (s *Server) Run(port int) error {
 	return s.engine.Run(fmt.Sprintf(":%d", port))
 }
+
+// Serve runs like Run until ctx is cancelled, then drains: readiness fails
+// for grace so balancers notice, after which open requests are given the
+// same grace to finish.
+func (s *Server) Serve(ctx context.Context, port int, grace time.Duration) error {
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: s.engine}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	s.Drain()
+	time.Sleep(grace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// splitList parses a comma-separated query value, dropping empty entries.
+func splitList(raw string) []string {
+	parts := strings.Split(raw, ",")
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		value := strings.TrimSpace(part)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// inboxErrorStatus maps inbox errors to HTTP status codes.
+func inboxErrorStatus(err error) int {
+	if errors.Is(err, ws.ErrInboxDisabled) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// historyErrorStatus maps message history errors to HTTP status codes.
+func historyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ws.ErrHistoryDisabled):
+		return http.StatusNotFound
+	case errors.Is(err, ws.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// groupErrorStatus maps group store errors to HTTP status codes.
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ws.ErrGroupNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ws.ErrGroupExists):
+		return http.StatusConflict
+	case errors.Is(err, ws.ErrInvalidGroup):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-playground/webapp"
+)
+
+// WithUI serves the embedded test UI at /ui, so one binary is enough for
+// demos and e2e runs without the nginx container.
+func WithUI() Option {
+	return func(s *Server) {
+		s.ui = true
+	}
+}
+
+// uiConfig tells the UI which node served it.
+type uiConfig struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Secure  bool   `json:"secure"`
+	WSURL   string `json:"wsUrl"`
+	HTTPURL string `json:"httpUrl"`
+}
+
+func mountUI(engine *gin.Engine) {
+	files := http.StripPrefix("/ui", http.FileServer(http.FS(webapp.Files)))
+	engine.GET("/ui", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/ui/")
+	})
+	engine.GET("/ui/*path", func(c *gin.Context) {
+		if c.Param("path") == "/config.json" {
+			c.JSON(http.StatusOK, nodeConfig(c.Request))
+			return
+		}
+		files.ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// nodeConfig derives this node's public address from the request, honouring
+// X-Forwarded-Proto from a TLS-terminating proxy.
+func nodeConfig(r *http.Request) uiConfig {
+	secure := r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+	host, rawPort, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, rawPort = r.Host, ""
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		port = 80
+		if secure {
+			port = 443
+		}
+	}
+	httpScheme, wsScheme := "http", "ws"
+	if secure {
+		httpScheme, wsScheme = "https", "wss"
+	}
+	return uiConfig{
+		Host:    host,
+		Port:    port,
+		Secure:  secure,
+		WSURL:   wsScheme + "://" + r.Host + "/ws",
+		HTTPURL: httpScheme + "://" + r.Host,
+	}
+}
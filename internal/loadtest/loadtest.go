@@ -0,0 +1,290 @@
+// Package loadtest drives many websocket connections against one or more hub
+// nodes and reports end-to-end latency, throughput and connection drops.
+//
+// Every frame carries its send timestamp, so latency is measured from the
+// sender's write to each group member's read, including cross-node hops.
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config controls the shape of a run.
+type Config struct {
+	// URLs are websocket endpoints, e.g. ws://localhost:8080/ws; connections
+	// are spread across them round-robin.
+	URLs        []string
+	Connections int
+	// Users and Groups bound how many distinct ids and groups are used.
+	Users  int
+	Groups int
+	// Rate is the total number of frames per second across all connections.
+	Rate     float64
+	Duration time.Duration
+	// PayloadSize pads each frame to roughly this many bytes.
+	PayloadSize int
+	// RampUp spreads connection setup over this window.
+	RampUp time.Duration
+	// Reconnect re-dials dropped connections after ReconnectDelay.
+	Reconnect      bool
+	ReconnectDelay time.Duration
+	// Drain waits this long after sending stops for in-flight frames.
+	Drain time.Duration
+}
+
+// DefaultConfig returns settings suitable for a quick local run.
+func DefaultConfig() Config {
+	return Config{
+		URLs:           []string{"ws://localhost:8080/ws"},
+		Connections:    100,
+		Users:          50,
+		Groups:         10,
+		Rate:           100,
+		Duration:       10 * time.Second,
+		PayloadSize:    128,
+		RampUp:         time.Second,
+		Reconnect:      true,
+		ReconnectDelay: 500 * time.Millisecond,
+		Drain:          time.Second,
+	}
+}
+
+// Validate rejects configurations that cannot run.
+func (c Config) Validate() error {
+	switch {
+	case len(c.URLs) == 0:
+		return errors.New("loadtest: at least one url is required")
+	case c.Connections <= 0:
+		return errors.New("loadtest: connections must be positive")
+	case c.Users <= 0 || c.Groups <= 0:
+		return errors.New("loadtest: users and groups must be positive")
+	case c.Rate <= 0:
+		return errors.New("loadtest: rate must be positive")
+	case c.Duration <= 0:
+		return errors.New("loadtest: duration must be positive")
+	}
+	for _, raw := range c.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+			return fmt.Errorf("loadtest: invalid websocket url %q", raw)
+		}
+	}
+	return nil
+}
+
+// frame is the JSON body every load frame carries.
+type frame struct {
+	SentAt int64  `json:"lt_sent"`
+	Seq    uint64 `json:"lt_seq"`
+	Conn   int    `json:"lt_conn"`
+	Pad    string `json:"pad,omitempty"`
+}
+
+// session is one simulated client.
+type session struct {
+	index int
+	url   string
+	id    string
+	group string
+	out   chan []byte
+}
+
+// runner holds shared counters for a run.
+type runner struct {
+	cfg        Config
+	recorder   *recorder
+	sent       atomic.Int64
+	received   atomic.Int64
+	expected   atomic.Int64
+	dialErrors atomic.Int64
+	drops      atomic.Int64
+	reconnects atomic.Int64
+	seq        atomic.Uint64
+	// groupOnline tracks connected members per group to estimate expected deliveries.
+	groupOnline []atomic.Int64
+}
+
+// Run executes the load test and returns the report. It stops early when
+// ctx is cancelled.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	r := &runner{cfg: cfg, recorder: newRecorder(), groupOnline: make([]atomic.Int64, cfg.Groups)}
+
+	sessions := make([]*session, cfg.Connections)
+	for i := range sessions {
+		sessions[i] = &session{
+			index: i,
+			url:   cfg.URLs[i%len(cfg.URLs)],
+			id:    "load-" + strconv.Itoa(i%cfg.Users),
+			group: "load-g" + strconv.Itoa(i%cfg.Groups),
+			out:   make(chan []byte, 16),
+		}
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func(s *session, delay time.Duration) {
+			defer wg.Done()
+			r.runSession(runCtx, s, delay)
+		}(s, rampDelay(cfg, i))
+	}
+
+	start := time.Now()
+	r.send(ctx, sessions)
+	sendElapsed := time.Since(start)
+
+	// Let in-flight frames arrive before closing connections.
+	select {
+	case <-time.After(cfg.Drain):
+	case <-ctx.Done():
+	}
+	stop()
+	wg.Wait()
+
+	return r.report(sendElapsed), nil
+}
+
+// rampDelay staggers connection i within the ramp-up window.
+func rampDelay(cfg Config, i int) time.Duration {
+	if cfg.RampUp <= 0 || cfg.Connections <= 1 {
+		return 0
+	}
+	return time.Duration(int64(cfg.RampUp) * int64(i) / int64(cfg.Connections))
+}
+
+// send paces frames across sessions until the duration elapses.
+func (r *runner) send(ctx context.Context, sessions []*session) {
+	interval := time.Duration(float64(time.Second) / r.cfg.Rate)
+	if interval <= 0 {
+		interval = time.Microsecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.After(r.cfg.RampUp + r.cfg.Duration)
+	pad := strings.Repeat("x", max(0, r.cfg.PayloadSize-64))
+
+	next := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+		s := sessions[next%len(sessions)]
+		next++
+		data, err := json.Marshal(frame{SentAt: time.Now().UnixNano(), Seq: r.seq.Add(1), Conn: s.index, Pad: pad})
+		if err != nil {
+			continue
+		}
+		select {
+		case s.out <- data:
+		default:
+			// The session is offline or backed up; skip rather than stall pacing.
+		}
+	}
+}
+
+// runSession keeps one connection alive, reconnecting when allowed.
+func (r *runner) runSession(ctx context.Context, s *session, delay time.Duration) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+	first := true
+	for ctx.Err() == nil {
+		if !first {
+			r.reconnects.Add(1)
+		}
+		first = false
+		dropped := r.connectOnce(ctx, s)
+		if !dropped || !r.cfg.Reconnect {
+			return
+		}
+		select {
+		case <-time.After(r.cfg.ReconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connectOnce runs a single connection and reports whether it dropped
+// unexpectedly (as opposed to the run ending).
+func (r *runner) connectOnce(ctx context.Context, s *session) bool {
+	target, _ := url.Parse(s.url)
+	query := target.Query()
+	query.Set("id", s.id)
+	query.Set("group", s.group)
+	target.RawQuery = query.Encode()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, target.String(), nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.dialErrors.Add(1)
+		}
+		return ctx.Err() == nil
+	}
+	defer conn.Close()
+
+	groupIndex := s.index % r.cfg.Groups
+	r.groupOnline[groupIndex].Add(1)
+	defer func() {
+		r.groupOnline[groupIndex].Add(-1)
+	}()
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var f frame
+			if json.Unmarshal(data, &f) != nil || f.SentAt == 0 {
+				continue
+			}
+			r.received.Add(1)
+			r.recorder.record(time.Since(time.Unix(0, f.SentAt)))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return false
+		case <-readDone:
+			r.drops.Add(1)
+			return true
+		case data := <-s.out:
+			_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				r.drops.Add(1)
+				return true
+			}
+			r.sent.Add(1)
+			// Group echo reaches every online member, including the sender.
+			r.expected.Add(r.groupOnline[groupIndex].Load())
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package loadtest_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-playground/internal/loadtest"
+	"go-playground/internal/wstest"
+)
+
+// TestRunAgainstCluster drives a small load across two in-process nodes so
+// CI exercises the full path without external services.
+func TestRunAgainstCluster(t *testing.T) {
+	cluster := wstest.NewCluster(t, 2)
+
+	cfg := loadtest.DefaultConfig()
+	cfg.URLs = []string{cluster.Node(0).WSURL(url.Values{}), cluster.Node(1).WSURL(url.Values{})}
+	cfg.Connections = 40
+	cfg.Users = 20
+	cfg.Groups = 4
+	cfg.Rate = 200
+	cfg.RampUp = 200 * time.Millisecond
+	cfg.Duration = 500 * time.Millisecond
+	cfg.Drain = 500 * time.Millisecond
+
+	report, err := loadtest.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Sent == 0 || report.Received == 0 {
+		t.Fatalf("sent %d, received %d; want traffic both ways", report.Sent, report.Received)
+	}
+	if report.Drops != 0 || report.DialErrors != 0 {
+		t.Fatalf("drops %d, dial errors %d; want none", report.Drops, report.DialErrors)
+	}
+	if report.Latency.Max == 0 || report.Latency.P50 > report.Latency.P99 {
+		t.Fatalf("implausible latency summary %+v", report.Latency)
+	}
+}
@@ -0,0 +1,144 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recorder collects latency samples. Samples are kept in full; a run of a
+// few minutes at thousands of frames per second fits comfortably in memory.
+type recorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func newRecorder() *recorder {
+	return &recorder{samples: make([]time.Duration, 0, 4096)}
+}
+
+func (r *recorder) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	r.mu.Lock()
+	r.samples = append(r.samples, d)
+	r.mu.Unlock()
+}
+
+// Latency summarises the end-to-end delivery latency of a run.
+type Latency struct {
+	Min  time.Duration `json:"min_ns"`
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P90  time.Duration `json:"p90_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Connections int           `json:"connections"`
+	Nodes       int           `json:"nodes"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	Sent        int64         `json:"sent"`
+	Received    int64         `json:"received"`
+	// Expected is the number of deliveries implied by group membership at
+	// send time; Lost is how many of those never arrived.
+	Expected   int64   `json:"expected"`
+	Lost       int64   `json:"lost"`
+	SendRate   float64 `json:"send_rate"`
+	RecvRate   float64 `json:"recv_rate"`
+	DialErrors int64   `json:"dial_errors"`
+	Drops      int64   `json:"drops"`
+	Reconnects int64   `json:"reconnects"`
+	Latency    Latency `json:"latency"`
+}
+
+func (r *runner) report(elapsed time.Duration) *Report {
+	report := &Report{
+		Connections: r.cfg.Connections,
+		Nodes:       len(r.cfg.URLs),
+		Elapsed:     elapsed,
+		Sent:        r.sent.Load(),
+		Received:    r.received.Load(),
+		Expected:    r.expected.Load(),
+		DialErrors:  r.dialErrors.Load(),
+		Drops:       r.drops.Load(),
+		Reconnects:  r.reconnects.Load(),
+	}
+	if lost := report.Expected - report.Received; lost > 0 {
+		report.Lost = lost
+	}
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		report.SendRate = float64(report.Sent) / seconds
+		report.RecvRate = float64(report.Received) / seconds
+	}
+	r.recorder.mu.Lock()
+	report.Latency = summarise(r.recorder.samples)
+	r.recorder.mu.Unlock()
+	return report
+}
+
+// summarise sorts samples in place and computes the latency summary.
+func summarise(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+	return Latency{
+		Min:  samples[0],
+		Mean: total / time.Duration(len(samples)),
+		P50:  percentile(samples, 50),
+		P90:  percentile(samples, 90),
+		P99:  percentile(samples, 99),
+		Max:  samples[len(samples)-1],
+	}
+}
+
+// percentile uses the nearest-rank method on sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// WriteText prints a human-readable summary.
+func (r *Report) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `connections  %d across %d node(s)
+elapsed      %s
+sent         %d (%.1f/s)
+received     %d (%.1f/s)
+expected     %d, lost %d
+dial errors  %d
+drops        %d, reconnects %d
+latency      min %s  mean %s  p50 %s  p90 %s  p99 %s  max %s
+`,
+		r.Connections, r.Nodes,
+		r.Elapsed.Round(time.Millisecond),
+		r.Sent, r.SendRate,
+		r.Received, r.RecvRate,
+		r.Expected, r.Lost,
+		r.DialErrors,
+		r.Drops, r.Reconnects,
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max,
+	)
+	return err
+}
+
+// WriteJSON prints the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,429 @@
+package memredis
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandFunc runs with s.mu held and returns the reply plus any pub/sub
+// pushes to deliver once the lock is released.
+type commandFunc func(s *Server, c *conn, args []string) (any, []push)
+
+// command describes arity like Redis: positive is exact, negative is a minimum.
+type command struct {
+	arity int
+	run   commandFunc
+}
+
+var commands map[string]command
+
+func init() {
+	channels := func(s *Server) map[string]map[*conn]struct{} { return s.channels }
+	patterns := func(s *Server) map[string]map[*conn]struct{} { return s.patterns }
+	shards := func(s *Server) map[string]map[*conn]struct{} { return s.shardChannels }
+	ownChannels := func(c *conn) map[string]struct{} { return c.channels }
+	ownPatterns := func(c *conn) map[string]struct{} { return c.patterns }
+	ownShards := func(c *conn) map[string]struct{} { return c.shardChannels }
+
+	commands = map[string]command{
+		// Connection and server.
+		"PING":     {-1, cmdPing},
+		"ECHO":     {2, func(_ *Server, _ *conn, args []string) (any, []push) { return args[1], nil }},
+		"HELLO":    {-1, cmdUnsupported},
+		"CLIENT":   {-2, cmdOK},
+		"SELECT":   {2, cmdOK},
+		"INFO":     {-1, cmdInfo},
+		"CLUSTER":  {-2, cmdCluster},
+		"DBSIZE":   {1, cmdDBSize},
+		"FLUSHALL": {-1, cmdFlushAll},
+		"FLUSHDB":  {-1, cmdFlushAll},
+
+		// Pub/sub.
+		"PUBLISH":      {3, cmdPublish},
+		"SPUBLISH":     {3, cmdSPublish},
+		"SUBSCRIBE":    {-2, subscribe("subscribe", channels, ownChannels)},
+		"UNSUBSCRIBE":  {-1, unsubscribe("unsubscribe", channels, ownChannels)},
+		"PSUBSCRIBE":   {-2, subscribe("psubscribe", patterns, ownPatterns)},
+		"PUNSUBSCRIBE": {-1, unsubscribe("punsubscribe", patterns, ownPatterns)},
+		"SSUBSCRIBE":   {-2, subscribe("ssubscribe", shards, ownShards)},
+		"SUNSUBSCRIBE": {-1, unsubscribe("sunsubscribe", shards, ownShards)},
+		"PUBSUB":       {-2, cmdPubSub},
+
+		// Keys.
+		"DEL":     {-2, cmdDel},
+		"EXISTS":  {-2, cmdExists},
+		"EXPIRE":  {3, cmdExpire(time.Second)},
+		"PEXPIRE": {3, cmdExpire(time.Millisecond)},
+		"TTL":     {2, cmdTTL(time.Second)},
+		"PTTL":    {2, cmdTTL(time.Millisecond)},
+		"TYPE":    {2, cmdType},
+		"KEYS":    {2, cmdKeys},
+
+		// Strings.
+		"GET":    {2, cmdGet},
+		"SET":    {-3, cmdSet},
+		"INCR":   {2, cmdIncrBy(1, false)},
+		"DECR":   {2, cmdIncrBy(-1, false)},
+		"INCRBY": {3, cmdIncrBy(1, true)},
+		"DECRBY": {3, cmdIncrBy(-1, true)},
+
+		// Hashes.
+		"HSET":    {-4, cmdHSet},
+		"HGET":    {3, cmdHGet},
+		"HGETALL": {2, cmdHGetAll},
+		"HDEL":    {-3, cmdHDel},
+		"HLEN":    {2, cmdHLen},
+
+		// Sorted sets.
+		"ZADD":             {-4, cmdZAdd},
+		"ZCARD":            {2, cmdZCard},
+		"ZREM":             {-3, cmdZRem},
+		"ZRANGEBYSCORE":    {-4, cmdZRangeByScore},
+		"ZREMRANGEBYSCORE": {4, cmdZRemRangeByScore},
+		"ZREMRANGEBYRANK":  {4, cmdZRemRangeByRank},
+
+		// Streams.
+		"XADD":      {-5, cmdXAdd},
+		"XLEN":      {2, cmdXLen},
+		"XRANGE":    {-4, cmdXRange(false)},
+		"XREVRANGE": {-4, cmdXRange(true)},
+	}
+}
+
+// writtenKeys names the keys each write command may modify, for WATCH.
+// Lazy expiry does not count as a write here.
+var writtenKeys = map[string]func(args []string) []string{
+	"DEL": func(args []string) []string { return args[1:] },
+}
+
+func init() {
+	firstKey := func(args []string) []string { return args[1:2] }
+	for _, name := range []string{
+		"EXPIRE", "PEXPIRE", "SET", "INCR", "DECR", "INCRBY", "DECRBY",
+		"HSET", "HDEL", "ZADD", "ZREM", "ZREMRANGEBYSCORE", "ZREMRANGEBYRANK", "XADD",
+	} {
+		writtenKeys[name] = firstKey
+	}
+}
+
+var (
+	errWrongType = errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errorReply("ERR value is not an integer or out of range")
+	errSyntax    = errorReply("ERR syntax error")
+)
+
+func cmdOK(*Server, *conn, []string) (any, []push) { return okReply, nil }
+
+func cmdUnsupported(_ *Server, _ *conn, args []string) (any, []push) {
+	return errorf("ERR unknown command '%s'", args[0]), nil
+}
+
+func cmdPing(_ *Server, c *conn, args []string) (any, []push) {
+	message := ""
+	if len(args) > 1 {
+		message = args[1]
+	}
+	// Subscribed connections get the pub/sub shaped pong, as in Redis.
+	if c.subscribed() {
+		return arrayReply{"pong", message}, nil
+	}
+	if len(args) > 1 {
+		return message, nil
+	}
+	return simpleString("PONG"), nil
+}
+
+func cmdInfo(s *Server, _ *conn, _ []string) (any, []push) {
+	info := fmt.Sprintf("# Server\r\nredis_version:7.2.0-memredis\r\n\r\n# Clients\r\nconnected_clients:%d\r\n\r\n# Keyspace\r\ndb0:keys=%d\r\n",
+		len(s.conns), len(s.entries))
+	return info, nil
+}
+
+// cmdCluster answers CLUSTER SLOTS as a one-node cluster owning every slot,
+// so cluster-mode clients and sharded pub/sub can run against the server.
+func cmdCluster(s *Server, _ *conn, args []string) (any, []push) {
+	if strings.ToUpper(args[1]) != "SLOTS" {
+		return errorf("ERR unknown subcommand '%s'", args[1]), nil
+	}
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		return errorf("ERR %v", err), nil
+	}
+	portNum, _ := strconv.Atoi(port)
+	return arrayReply{arrayReply{0, 16383, arrayReply{host, portNum, "memredis"}}}, nil
+}
+
+func cmdDBSize(s *Server, _ *conn, _ []string) (any, []push) {
+	return len(s.entries), nil
+}
+
+func cmdFlushAll(s *Server, _ *conn, _ []string) (any, []push) {
+	for key := range s.entries {
+		s.versions[key]++
+	}
+	s.entries = make(map[string]*entry)
+	return okReply, nil
+}
+
+func cmdDel(s *Server, _ *conn, args []string) (any, []push) {
+	removed := 0
+	for _, key := range args[1:] {
+		if s.lookup(key) != nil {
+			delete(s.entries, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func cmdExists(s *Server, _ *conn, args []string) (any, []push) {
+	found := 0
+	for _, key := range args[1:] {
+		if s.lookup(key) != nil {
+			found++
+		}
+	}
+	return found, nil
+}
+
+func cmdExpire(unit time.Duration) commandFunc {
+	return func(s *Server, _ *conn, args []string) (any, []push) {
+		amount, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return errNotInt, nil
+		}
+		e := s.lookup(args[1])
+		if e == nil {
+			return 0, nil
+		}
+		if amount <= 0 {
+			delete(s.entries, args[1])
+			return 1, nil
+		}
+		e.expireAt = time.Now().Add(time.Duration(amount) * unit)
+		return 1, nil
+	}
+}
+
+func cmdTTL(unit time.Duration) commandFunc {
+	return func(s *Server, _ *conn, args []string) (any, []push) {
+		e := s.lookup(args[1])
+		if e == nil {
+			return -2, nil
+		}
+		if e.expireAt.IsZero() {
+			return -1, nil
+		}
+		return int64(time.Until(e.expireAt) / unit), nil
+	}
+}
+
+func cmdType(s *Server, _ *conn, args []string) (any, []push) {
+	e := s.lookup(args[1])
+	if e == nil {
+		return simpleString("none"), nil
+	}
+	switch e.value.(type) {
+	case string:
+		return simpleString("string"), nil
+	case map[string]string:
+		return simpleString("hash"), nil
+	case *zset:
+		return simpleString("zset"), nil
+	case *stream:
+		return simpleString("stream"), nil
+	}
+	return simpleString("none"), nil
+}
+
+func cmdKeys(s *Server, _ *conn, args []string) (any, []push) {
+	keys := make([]string, 0)
+	for key := range s.entries {
+		if s.lookup(key) != nil && matchGlob(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func cmdGet(s *Server, _ *conn, args []string) (any, []push) {
+	e := s.lookup(args[1])
+	if e == nil {
+		return nullBulk{}, nil
+	}
+	value, ok := e.value.(string)
+	if !ok {
+		return errWrongType, nil
+	}
+	return value, nil
+}
+
+// cmdSet supports EX, PX, NX, XX and KEEPTTL.
+func cmdSet(s *Server, _ *conn, args []string) (any, []push) {
+	key, value := args[1], args[2]
+	var expireAt time.Time
+	var nx, xx, keepTTL bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax, nil
+			}
+			amount, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || amount <= 0 {
+				return errNotInt, nil
+			}
+			unit := time.Second
+			if strings.EqualFold(args[i], "PX") {
+				unit = time.Millisecond
+			}
+			expireAt = time.Now().Add(time.Duration(amount) * unit)
+			i++
+		default:
+			return errSyntax, nil
+		}
+	}
+	existing := s.lookup(key)
+	if nx && existing != nil || xx && existing == nil {
+		return nullBulk{}, nil
+	}
+	if keepTTL && existing != nil {
+		expireAt = existing.expireAt
+	}
+	s.entries[key] = &entry{value: value, expireAt: expireAt}
+	return okReply, nil
+}
+
+func cmdIncrBy(sign int64, withAmount bool) commandFunc {
+	return func(s *Server, _ *conn, args []string) (any, []push) {
+		delta := sign
+		if withAmount {
+			amount, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				return errNotInt, nil
+			}
+			delta = sign * amount
+		}
+		var current int64
+		e := s.lookup(args[1])
+		if e != nil {
+			raw, ok := e.value.(string)
+			if !ok {
+				return errWrongType, nil
+			}
+			parsed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return errNotInt, nil
+			}
+			current = parsed
+		} else {
+			e = &entry{}
+			s.entries[args[1]] = e
+		}
+		current += delta
+		e.value = strconv.FormatInt(current, 10)
+		return current, nil
+	}
+}
+
+// hash returns the hash at key, creating it when create is set.
+func (s *Server) hash(key string, create bool) (map[string]string, errorReply) {
+	e := s.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, ""
+		}
+		h := make(map[string]string)
+		s.entries[key] = &entry{value: h}
+		return h, ""
+	}
+	h, ok := e.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, ""
+}
+
+func cmdHSet(s *Server, _ *conn, args []string) (any, []push) {
+	if len(args)%2 != 0 {
+		return errorReply("ERR wrong number of arguments for 'hset' command"), nil
+	}
+	h, errReply := s.hash(args[1], true)
+	if errReply != "" {
+		return errReply, nil
+	}
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			added++
+		}
+		h[args[i]] = args[i+1]
+	}
+	return added, nil
+}
+
+func cmdHGet(s *Server, _ *conn, args []string) (any, []push) {
+	h, errReply := s.hash(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	value, ok := h[args[2]]
+	if !ok {
+		return nullBulk{}, nil
+	}
+	return value, nil
+}
+
+func cmdHGetAll(s *Server, _ *conn, args []string) (any, []push) {
+	h, errReply := s.hash(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	reply := make([]string, 0, 2*len(h))
+	for _, field := range fields {
+		reply = append(reply, field, h[field])
+	}
+	return reply, nil
+}
+
+func cmdHDel(s *Server, _ *conn, args []string) (any, []push) {
+	h, errReply := s.hash(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	removed := 0
+	for _, field := range args[2:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			removed++
+		}
+	}
+	if h != nil && len(h) == 0 {
+		delete(s.entries, args[1])
+	}
+	return removed, nil
+}
+
+func cmdHLen(s *Server, _ *conn, args []string) (any, []push) {
+	h, errReply := s.hash(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	return len(h), nil
+}
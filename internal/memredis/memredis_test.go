@@ -0,0 +1,234 @@
+package memredis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReadCommand(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", []string{"GET", "k"}, ""},
+		{"*1\r\n$0\r\n\r\n", []string{""}, ""},
+		{"PING  hello\r\n", []string{"PING", "hello"}, ""},
+		{"*1\r\n:3\r\n", nil, "expected bulk string"},
+		{"*-5\r\n", nil, "invalid multibulk length"},
+		{"*2147483647\r\n", nil, "invalid multibulk length"},
+		{"*1\r\n$9999999999\r\n", nil, "invalid bulk length"},
+		{"*1\r\n$536870911\r\n", nil, "invalid bulk length"},
+		{"*1\r\n$1\r\nab\r\n", nil, "not terminated by CRLF"},
+		{strings.Repeat("a", maxLineLen+1) + "\r\n", nil, "line too long"},
+		{"*1\r\n$-1\r\n", nil, "invalid bulk length"},
+		{"PING\n", nil, "not terminated by CRLF"},
+	}
+	for _, tc := range cases {
+		got, err := readCommand(bufio.NewReader(strings.NewReader(tc.input)))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tc.input, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%q: got %q, %v; want %q", tc.input, got, err, tc.want)
+		}
+	}
+}
+
+func TestReadCommandGrowsWithData(t *testing.T) {
+	// A maximal header followed by a few bytes must not allocate the
+	// announced size up front.
+	input := fmt.Sprintf("*1\r\n$%d\r\nabc", maxBulkLen)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readCommand(bufio.NewReader(strings.NewReader(input)))
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("truncated bulk string accepted")
+	}
+	if grown := after.TotalAlloc - before.TotalAlloc; grown > 1<<20 {
+		t.Fatalf("truncated request allocated %d bytes", grown)
+	}
+}
+
+// start serves a fresh server and returns a client for it.
+func start(t *testing.T) (*Server, *redis.Client) {
+	t.Helper()
+	srv := New()
+	if err := srv.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr(), Protocol: 2})
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
+
+func TestPubSub(t *testing.T) {
+	srv, client := start(t)
+	ctx := context.Background()
+
+	sub := client.Subscribe(ctx, "news")
+	defer sub.Close()
+	psub := client.PSubscribe(ctx, "orders.*")
+	defer psub.Close()
+	ssub := client.SSubscribe(ctx, "shard")
+	defer ssub.Close()
+	for _, ps := range []*redis.PubSub{sub, psub, ssub} {
+		if _, err := ps.Receive(ctx); err != nil {
+			t.Fatalf("subscribe confirmation: %v", err)
+		}
+	}
+	if srv.NumSub("news") != 1 || srv.NumSub("shard") != 1 {
+		t.Fatalf("numsub news=%d shard=%d, want 1 each", srv.NumSub("news"), srv.NumSub("shard"))
+	}
+	if counts, err := client.PubSubShardNumSub(ctx, "shard").Result(); err != nil || counts["shard"] != 1 {
+		t.Fatalf("SHARDNUMSUB = %v, %v", counts, err)
+	}
+
+	if n, err := client.Publish(ctx, "news", "hello").Result(); err != nil || n != 1 {
+		t.Fatalf("PUBLISH = %d, %v", n, err)
+	}
+	if n, err := client.Publish(ctx, "orders.eu", "order").Result(); err != nil || n != 1 {
+		t.Fatalf("PUBLISH to pattern = %d, %v", n, err)
+	}
+	if n, err := client.SPublish(ctx, "shard", "sharded").Result(); err != nil || n != 1 {
+		t.Fatalf("SPUBLISH = %d, %v", n, err)
+	}
+	for ps, want := range map[*redis.PubSub]string{sub: "hello", psub: "order", ssub: "sharded"} {
+		select {
+		case msg := <-ps.Channel():
+			if msg.Payload != want {
+				t.Fatalf("payload = %q, want %q", msg.Payload, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no message %q", want)
+		}
+	}
+}
+
+func TestSortedSets(t *testing.T) {
+	_, client := start(t)
+	ctx := context.Background()
+
+	client.ZAdd(ctx, "z", redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"})
+	got, err := client.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "(1", Max: "+inf"}).Result()
+	if err != nil || strings.Join(got, ",") != "b,c" {
+		t.Fatalf("ZRANGEBYSCORE = %v, %v", got, err)
+	}
+	got, _ = client.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "-inf", Max: "+inf", Offset: 1, Count: 1}).Result()
+	if strings.Join(got, ",") != "b" {
+		t.Fatalf("ZRANGEBYSCORE LIMIT = %v", got)
+	}
+	if n, _ := client.ZRemRangeByRank(ctx, "z", 0, 0).Result(); n != 1 {
+		t.Fatalf("ZREMRANGEBYRANK removed %d, want 1", n)
+	}
+	if n, _ := client.ZRem(ctx, "z", "b", "missing").Result(); n != 1 {
+		t.Fatalf("ZREM removed %d, want 1", n)
+	}
+	if n, _ := client.ZCard(ctx, "z").Result(); n != 1 {
+		t.Fatalf("ZCARD = %d, want 1", n)
+	}
+	client.ZRemRangeByScore(ctx, "z", "-inf", "+inf")
+	if n, _ := client.Exists(ctx, "z").Result(); n != 0 {
+		t.Fatal("emptied sorted set still exists")
+	}
+	client.Set(ctx, "s", "v", 0)
+	if err := client.ZAdd(ctx, "s", redis.Z{Score: 1, Member: "x"}).Err(); err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		t.Fatalf("ZADD on string = %v, want WRONGTYPE", err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	_, client := start(t)
+	ctx := context.Background()
+
+	var ids []string
+	for _, body := range []string{"a", "b", "c", "d"} {
+		id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: "log", MaxLen: 3, Values: []string{"body", body}}).Result()
+		if err != nil {
+			t.Fatalf("XADD: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if n, _ := client.XLen(ctx, "log").Result(); n != 3 {
+		t.Fatalf("XLEN = %d, want 3 after MAXLEN trim", n)
+	}
+	bodies := func(msgs []redis.XMessage) string {
+		var out []string
+		for _, m := range msgs {
+			out = append(out, m.Values["body"].(string))
+		}
+		return strings.Join(out, ",")
+	}
+	if msgs, _ := client.XRange(ctx, "log", "-", "+").Result(); bodies(msgs) != "b,c,d" {
+		t.Fatalf("XRANGE = %s", bodies(msgs))
+	}
+	if msgs, _ := client.XRevRangeN(ctx, "log", "("+ids[3], "-", 1).Result(); bodies(msgs) != "c" {
+		t.Fatalf("XREVRANGE exclusive = %s", bodies(msgs))
+	}
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: "log", ID: "1-1", Values: []string{"body", "old"}}).Err(); err == nil {
+		t.Fatal("XADD with an id below the top item succeeded")
+	}
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: "none", NoMkStream: true, Values: []string{"k", "v"}}).Err(); err != redis.Nil {
+		t.Fatalf("XADD NOMKSTREAM = %v, want nil reply", err)
+	}
+	if typ, _ := client.Type(ctx, "log").Result(); typ != "stream" {
+		t.Fatalf("TYPE = %s, want stream", typ)
+	}
+}
+
+func TestWatchAbortsOnConcurrentWrite(t *testing.T) {
+	_, client := start(t)
+	ctx := context.Background()
+	client.Set(ctx, "k", "1", 0)
+
+	attempts := 0
+	err := client.Watch(ctx, func(tx *redis.Tx) error {
+		attempts++
+		if attempts == 1 {
+			// Another client writes the watched key mid-transaction.
+			client.Set(ctx, "k", "2", 0)
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "k", "3", 0)
+			return nil
+		})
+		return err
+	}, "k")
+	if err != redis.TxFailedErr {
+		t.Fatalf("watch after concurrent write = %v, want TxFailedErr", err)
+	}
+	if got, _ := client.Get(ctx, "k").Result(); got != "2" {
+		t.Fatalf("k = %q, want the concurrent write to win", got)
+	}
+
+	err = client.Watch(ctx, func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "k", "4", 0)
+			return nil
+		})
+		return err
+	}, "k")
+	if got, _ := client.Get(ctx, "k").Result(); err != nil || got != "4" {
+		t.Fatalf("uncontended watch = %v, k = %q", err, got)
+	}
+}
+
+func TestClusterSlots(t *testing.T) {
+	srv, client := start(t)
+	slots, err := client.ClusterSlots(context.Background()).Result()
+	if err != nil || len(slots) != 1 || slots[0].Start != 0 || slots[0].End != 16383 || slots[0].Nodes[0].Addr != srv.Addr() {
+		t.Fatalf("CLUSTER SLOTS = %+v, %v", slots, err)
+	}
+}
@@ -0,0 +1,143 @@
+package memredis
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// subscribe handles SUBSCRIBE, PSUBSCRIBE and SSUBSCRIBE.
+func subscribe(kind string, registry func(*Server) map[string]map[*conn]struct{}, local func(*conn) map[string]struct{}) commandFunc {
+	return func(s *Server, c *conn, args []string) (any, []push) {
+		global, own := registry(s), local(c)
+		replies := make(multiReply, 0, len(args)-1)
+		for _, name := range args[1:] {
+			if _, ok := own[name]; !ok {
+				own[name] = struct{}{}
+				if global[name] == nil {
+					global[name] = make(map[*conn]struct{})
+				}
+				global[name][c] = struct{}{}
+			}
+			replies = append(replies, arrayReply{kind, name, subscriptionCount(kind, c)})
+		}
+		return replies, nil
+	}
+}
+
+// unsubscribe handles UNSUBSCRIBE, PUNSUBSCRIBE and SUNSUBSCRIBE; with no
+// arguments it drops every subscription of that kind.
+func unsubscribe(kind string, registry func(*Server) map[string]map[*conn]struct{}, local func(*conn) map[string]struct{}) commandFunc {
+	return func(s *Server, c *conn, args []string) (any, []push) {
+		global, own := registry(s), local(c)
+		names := args[1:]
+		if len(names) == 0 {
+			for name := range own {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			return multiReply{arrayReply{kind, nullBulk{}, subscriptionCount(kind, c)}}, nil
+		}
+		replies := make(multiReply, 0, len(names))
+		for _, name := range names {
+			if _, ok := own[name]; ok {
+				delete(own, name)
+				removeSubscriber(global, name, c)
+			}
+			replies = append(replies, arrayReply{kind, name, subscriptionCount(kind, c)})
+		}
+		return replies, nil
+	}
+}
+
+// subscriptionCount mirrors Redis: sharded channels are counted separately.
+func subscriptionCount(kind string, c *conn) int {
+	if strings.HasPrefix(kind, "s") {
+		return len(c.shardChannels)
+	}
+	return len(c.channels) + len(c.patterns)
+}
+
+func removeSubscriber(global map[string]map[*conn]struct{}, name string, c *conn) {
+	subs := global[name]
+	if subs == nil {
+		return
+	}
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(global, name)
+	}
+}
+
+func cmdPublish(s *Server, _ *conn, args []string) (any, []push) {
+	channel, payload := args[1], args[2]
+	var pushes []push
+	for sub := range s.channels[channel] {
+		pushes = append(pushes, push{to: sub, reply: arrayReply{"message", channel, payload}})
+	}
+	for pattern, subs := range s.patterns {
+		if !matchGlob(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			pushes = append(pushes, push{to: sub, reply: arrayReply{"pmessage", pattern, channel, payload}})
+		}
+	}
+	return len(pushes), pushes
+}
+
+func cmdSPublish(s *Server, _ *conn, args []string) (any, []push) {
+	channel, payload := args[1], args[2]
+	var pushes []push
+	for sub := range s.shardChannels[channel] {
+		pushes = append(pushes, push{to: sub, reply: arrayReply{"smessage", channel, payload}})
+	}
+	return len(pushes), pushes
+}
+
+func cmdPubSub(s *Server, _ *conn, args []string) (any, []push) {
+	switch strings.ToUpper(args[1]) {
+	case "NUMSUB":
+		reply := make(arrayReply, 0, 2*(len(args)-2))
+		for _, channel := range args[2:] {
+			reply = append(reply, channel, len(s.channels[channel]))
+		}
+		return reply, nil
+	case "SHARDNUMSUB":
+		reply := make(arrayReply, 0, 2*(len(args)-2))
+		for _, channel := range args[2:] {
+			reply = append(reply, channel, len(s.shardChannels[channel]))
+		}
+		return reply, nil
+	case "NUMPAT":
+		return len(s.patterns), nil
+	case "CHANNELS", "SHARDCHANNELS":
+		registry := s.channels
+		if strings.EqualFold(args[1], "SHARDCHANNELS") {
+			registry = s.shardChannels
+		}
+		pattern := "*"
+		if len(args) > 2 {
+			pattern = args[2]
+		}
+		names := make([]string, 0)
+		for name := range registry {
+			if matchGlob(pattern, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	default:
+		return errorf("ERR unknown subcommand '%s'", args[1]), nil
+	}
+}
+
+// matchGlob supports the * ? and [] wildcards used with PSUBSCRIBE. Unlike
+// path.Match, * also crosses '/' so arbitrary channel names behave as in Redis.
+func matchGlob(pattern, name string) bool {
+	ok, err := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+	return err == nil && ok
+}
@@ -0,0 +1,152 @@
+package memredis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Reply values produced by commands and serialized as RESP2.
+type (
+	simpleString string
+	errorReply   string
+	bulkString   string
+	nullBulk     struct{}
+	nullArray    struct{}
+	arrayReply   []any
+	// multiReply is written as consecutive top-level replies, which is how
+	// SUBSCRIBE and friends confirm each channel.
+	multiReply []any
+)
+
+var (
+	okReply     = simpleString("OK")
+	queuedReply = simpleString("QUEUED")
+)
+
+// Request size limits. Values are far above anything the hub sends (frames
+// are capped at 1 MiB) but well below Redis's own defaults, and bulk
+// buffers only grow as bytes arrive, so a length header alone cannot
+// exhaust memory.
+const (
+	maxMultibulkLen = 64 * 1024
+	maxBulkLen      = 16 * 1024 * 1024
+	// maxLineLen bounds inline commands and length headers, like Redis's
+	// 64 KiB inline limit.
+	maxLineLen = 64 * 1024
+)
+
+func errorf(format string, args ...any) errorReply {
+	return errorReply(fmt.Sprintf(format, args...))
+}
+
+// readCommand reads one command as a RESP array of bulk strings, or as an
+// inline command so redis-cli style input over telnet also works.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > maxMultibulkLen {
+		return nil, fmt.Errorf("invalid multibulk length %q", line)
+	}
+	// Grow with the data actually sent rather than trusting the header.
+	args := make([]string, 0, min(count, 64))
+	for i := 0; i < count; i++ {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if header == "" || header[0] != '$' {
+			return nil, fmt.Errorf("expected bulk string, got %q", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("invalid bulk length %q", header)
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+			return nil, err
+		}
+		var crlf [2]byte
+		if _, err := io.ReadFull(r, crlf[:]); err != nil {
+			return nil, err
+		}
+		if crlf != [2]byte{'\r', '\n'} {
+			return nil, errors.New("protocol error: bulk string not terminated by CRLF")
+		}
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// readLine reads one CRLF-terminated line of at most maxLineLen bytes.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineLen {
+			return "", errors.New("protocol error: line too long")
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return "", err
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", errors.New("protocol error: line not terminated by CRLF")
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+// writeReply serializes a reply value.
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case simpleString:
+		w.WriteString("+" + string(v) + "\r\n")
+	case errorReply:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case bulkString:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + string(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case nullBulk:
+		w.WriteString("$-1\r\n")
+	case nullArray:
+		w.WriteString("*-1\r\n")
+	case arrayReply:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	case []string:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	case multiReply:
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		w.WriteString("-ERR internal: unsupported reply type\r\n")
+	}
+}
@@ -0,0 +1,361 @@
+// Package memredis is an in-memory, Redis-compatible stand-in that speaks
+// enough RESP2 for the hub backplane: pub/sub (plain, pattern and sharded),
+// transactions, the string, hash, sorted-set and stream commands the hub
+// uses, and CLUSTER SLOTS as a single-node cluster.
+// It exists for tests and Docker-free local runs; it is not a Redis.
+package memredis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a single-process Redis stand-in.
+type Server struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+
+	// Keyspace and pub/sub registries, guarded by mu.
+	entries       map[string]*entry
+	channels      map[string]map[*conn]struct{}
+	patterns      map[string]map[*conn]struct{}
+	shardChannels map[string]map[*conn]struct{}
+	// versions counts writes per key so EXEC can abort watched transactions.
+	versions map[string]uint64
+}
+
+// conn is one client connection with its pub/sub and MULTI state.
+type conn struct {
+	netConn net.Conn
+	wmu     sync.Mutex
+	w       *bufio.Writer
+
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+
+	inMulti bool
+	queued  [][]string
+	dirty   bool
+	// watching maps WATCHed keys to their version when watched.
+	watching map[string]uint64
+}
+
+// push is a message delivered to a subscriber outside the normal reply flow.
+type push struct {
+	to    *conn
+	reply any
+}
+
+// New returns a server with an empty keyspace. Call Start to listen.
+func New() *Server {
+	return &Server{
+		conns:         make(map[*conn]struct{}),
+		entries:       make(map[string]*entry),
+		channels:      make(map[string]map[*conn]struct{}),
+		patterns:      make(map[string]map[*conn]struct{}),
+		shardChannels: make(map[string]map[*conn]struct{}),
+		versions:      make(map[string]uint64),
+	}
+}
+
+// Start listens on addr (use "127.0.0.1:0" for a random port) and serves
+// connections in the background.
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(listener)
+	return nil
+}
+
+// Addr returns the listening address, or "" before Start.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops listening and drops every client connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	listener := s.listener
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	var err error
+	if listener != nil {
+		err = listener.Close()
+	}
+	for _, c := range conns {
+		_ = c.netConn.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// NumSub reports how many connections subscribe to a plain or sharded channel.
+func (s *Server) NumSub(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels[channel]) + len(s.shardChannels[channel])
+}
+
+// Subscribers reports how many connections are in pub/sub mode.
+func (s *Server) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for c := range s.conns {
+		if c.subscribed() {
+			n++
+		}
+	}
+	return n
+}
+
+// Clients reports the number of open client connections.
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *Server) acceptLoop(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{
+			netConn:       netConn,
+			w:             bufio.NewWriter(netConn),
+			channels:      make(map[string]struct{}),
+			patterns:      make(map[string]struct{}),
+			shardChannels: make(map[string]struct{}),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = netConn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// serve reads commands until the client disconnects.
+func (s *Server) serve(c *conn) {
+	defer s.wg.Done()
+	defer s.drop(c)
+
+	r := bufio.NewReader(c.netConn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.write(errorReply("ERR Protocol error: " + err.Error()))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.EqualFold(args[0], "QUIT") {
+			c.write(okReply)
+			return
+		}
+		reply, pushes := s.dispatch(c, args)
+		c.write(reply)
+		deliver(pushes)
+	}
+}
+
+// dispatch handles MULTI queueing and runs the command under the server lock.
+func (s *Server) dispatch(c *conn, args []string) (any, []push) {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if c.inMulti {
+			return errorReply("ERR MULTI calls can not be nested"), nil
+		}
+		c.inMulti, c.queued, c.dirty = true, nil, false
+		return okReply, nil
+	case "DISCARD":
+		if !c.inMulti {
+			return errorReply("ERR DISCARD without MULTI"), nil
+		}
+		c.inMulti, c.queued, c.watching = false, nil, nil
+		return okReply, nil
+	case "EXEC":
+		if !c.inMulti {
+			return errorReply("ERR EXEC without MULTI"), nil
+		}
+		queued, dirty, watching := c.queued, c.dirty, c.watching
+		c.inMulti, c.queued, c.watching = false, nil, nil
+		if dirty {
+			return errorReply("EXECABORT Transaction discarded because of previous errors."), nil
+		}
+		s.mu.Lock()
+		for key, version := range watching {
+			if s.versions[key] != version {
+				// A watched key changed: abort with a null reply like Redis.
+				s.mu.Unlock()
+				return nullArray{}, nil
+			}
+		}
+		replies := make(arrayReply, 0, len(queued))
+		var pushes []push
+		for _, cmd := range queued {
+			reply, p := s.execLocked(c, cmd)
+			replies = append(replies, reply)
+			pushes = append(pushes, p...)
+		}
+		s.mu.Unlock()
+		return replies, pushes
+	case "WATCH":
+		if c.inMulti {
+			return errorReply("ERR WATCH inside MULTI is not allowed"), nil
+		}
+		if len(args) < 2 {
+			return errorReply("ERR wrong number of arguments for 'watch' command"), nil
+		}
+		s.mu.Lock()
+		if c.watching == nil {
+			c.watching = make(map[string]uint64)
+		}
+		for _, key := range args[1:] {
+			if _, ok := c.watching[key]; !ok {
+				c.watching[key] = s.versions[key]
+			}
+		}
+		s.mu.Unlock()
+		return okReply, nil
+	case "UNWATCH":
+		c.watching = nil
+		return okReply, nil
+	}
+
+	if c.inMulti {
+		if _, ok := commands[name]; !ok {
+			c.dirty = true
+			return errorf("ERR unknown command '%s'", args[0]), nil
+		}
+		c.queued = append(c.queued, args)
+		return queuedReply, nil
+	}
+
+	s.mu.Lock()
+	reply, pushes := s.execLocked(c, args)
+	s.mu.Unlock()
+	return reply, pushes
+}
+
+// execLocked runs one command; the caller holds s.mu.
+func (s *Server) execLocked(c *conn, args []string) (any, []push) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return errorf("ERR unknown command '%s'", args[0]), nil
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		return errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])), nil
+	}
+	reply, pushes := cmd.run(s, c, args)
+	if written, ok := writtenKeys[name]; ok {
+		if _, failed := reply.(errorReply); !failed {
+			for _, key := range written(args) {
+				s.versions[key]++
+			}
+		}
+	}
+	return reply, pushes
+}
+
+// drop removes a closed connection from every registry.
+func (s *Server) drop(c *conn) {
+	_ = c.netConn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+	for channel := range c.channels {
+		removeSubscriber(s.channels, channel, c)
+	}
+	for pattern := range c.patterns {
+		removeSubscriber(s.patterns, pattern, c)
+	}
+	for channel := range c.shardChannels {
+		removeSubscriber(s.shardChannels, channel, c)
+	}
+}
+
+// write sends one reply and flushes.
+func (c *conn) write(reply any) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	writeReply(c.w, reply)
+	if err := c.w.Flush(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("memredis write failed: %v", err)
+	}
+}
+
+// subscribed reports whether the connection is in pub/sub mode.
+func (c *conn) subscribed() bool {
+	return len(c.channels)+len(c.patterns)+len(c.shardChannels) > 0
+}
+
+func deliver(pushes []push) {
+	for _, p := range pushes {
+		p.to.write(p.reply)
+	}
+}
+
+// entry is one key with an optional expiry.
+type entry struct {
+	value    any
+	expireAt time.Time
+}
+
+// lookup returns a live entry, expiring it lazily; the caller holds s.mu.
+func (s *Server) lookup(key string) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
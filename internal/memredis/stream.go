@@ -0,0 +1,250 @@
+package memredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stream is an append-only log of field/value entries ordered by id.
+type stream struct {
+	entries []streamEntry
+	last    streamID
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+// streamID is a <milliseconds>-<sequence> entry id.
+type streamID struct {
+	ms, seq uint64
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseStreamID reads "ms-seq" or a bare "ms", which takes missingSeq.
+func parseStreamID(raw string, missingSeq uint64) (streamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(raw, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	if !hasSeq {
+		return streamID{ms: ms, seq: missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	return streamID{ms: ms, seq: seq}, true
+}
+
+// streamBound is one end of an XRANGE interval; "(" makes it exclusive.
+type streamBound struct {
+	id        streamID
+	exclusive bool
+}
+
+func parseStreamBound(raw string, start bool) (streamBound, bool) {
+	switch raw {
+	case "-":
+		return streamBound{}, true
+	case "+":
+		return streamBound{id: streamID{ms: math.MaxUint64, seq: math.MaxUint64}}, true
+	}
+	bound := streamBound{}
+	if strings.HasPrefix(raw, "(") {
+		bound.exclusive = true
+		raw = raw[1:]
+	}
+	missingSeq := uint64(0)
+	if !start {
+		missingSeq = math.MaxUint64
+	}
+	id, ok := parseStreamID(raw, missingSeq)
+	bound.id = id
+	return bound, ok
+}
+
+func (b streamBound) after(id streamID) bool {
+	if b.exclusive {
+		return b.id.less(id)
+	}
+	return !id.less(b.id)
+}
+
+func (b streamBound) before(id streamID) bool {
+	if b.exclusive {
+		return id.less(b.id)
+	}
+	return !b.id.less(id)
+}
+
+var errStreamID = errorReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+
+// streamAt returns the stream at key, creating it when create is set.
+func (s *Server) streamAt(key string, create bool) (*stream, errorReply) {
+	e := s.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, ""
+		}
+		st := &stream{}
+		s.entries[key] = &entry{value: st}
+		return st, ""
+	}
+	st, ok := e.value.(*stream)
+	if !ok {
+		return nil, errWrongType
+	}
+	return st, ""
+}
+
+// cmdXAdd supports NOMKSTREAM, MAXLEN [=|~] n and ids "*", "ms-*" or
+// explicit; approximate trimming is exact here.
+func cmdXAdd(s *Server, _ *conn, args []string) (any, []push) {
+	key := args[1]
+	create := true
+	maxLen := -1
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			create = false
+			continue
+		case "MAXLEN":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				i++
+			}
+			if i >= len(args) {
+				return errSyntax, nil
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return errNotInt, nil
+			}
+			maxLen = n
+			continue
+		case "LIMIT":
+			i++
+			continue
+		}
+		break options
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return errorReply("ERR wrong number of arguments for 'xadd' command"), nil
+	}
+	st, errReply := s.streamAt(key, create)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if st == nil {
+		return nullBulk{}, nil
+	}
+	id, ok := nextStreamID(st.last, args[i])
+	if !ok {
+		return errorReply("ERR Invalid stream ID specified as stream command argument"), nil
+	}
+	if !st.last.less(id) {
+		return errStreamID, nil
+	}
+	st.last = id
+	st.entries = append(st.entries, streamEntry{id: id, fields: append([]string(nil), args[i+1:]...)})
+	if maxLen >= 0 && len(st.entries) > maxLen {
+		st.entries = append([]streamEntry(nil), st.entries[len(st.entries)-maxLen:]...)
+	}
+	return id.String(), nil
+}
+
+// nextStreamID resolves an XADD id argument against the stream's last id.
+func nextStreamID(last streamID, raw string) (streamID, bool) {
+	if raw == "*" {
+		ms := uint64(time.Now().UnixMilli())
+		if ms <= last.ms {
+			return streamID{ms: last.ms, seq: last.seq + 1}, true
+		}
+		return streamID{ms: ms}, true
+	}
+	if msPart, ok := strings.CutSuffix(raw, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return streamID{}, false
+		}
+		if ms == last.ms {
+			return streamID{ms: ms, seq: last.seq + 1}, true
+		}
+		return streamID{ms: ms}, true
+	}
+	return parseStreamID(raw, 0)
+}
+
+func cmdXLen(s *Server, _ *conn, args []string) (any, []push) {
+	st, errReply := s.streamAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if st == nil {
+		return 0, nil
+	}
+	return len(st.entries), nil
+}
+
+// cmdXRange serves XRANGE and, with reverse set, XREVRANGE, whose bounds
+// come end first.
+func cmdXRange(reverse bool) commandFunc {
+	return func(s *Server, _ *conn, args []string) (any, []push) {
+		startRaw, endRaw := args[2], args[3]
+		if reverse {
+			startRaw, endRaw = endRaw, startRaw
+		}
+		start, okStart := parseStreamBound(startRaw, true)
+		end, okEnd := parseStreamBound(endRaw, false)
+		if !okStart || !okEnd {
+			return errorReply("ERR Invalid stream ID specified as stream command argument"), nil
+		}
+		count := -1
+		if len(args) > 4 {
+			if len(args) != 6 || strings.ToUpper(args[4]) != "COUNT" {
+				return errSyntax, nil
+			}
+			n, err := strconv.Atoi(args[5])
+			if err != nil {
+				return errNotInt, nil
+			}
+			count = n
+		}
+		st, errReply := s.streamAt(args[1], false)
+		if errReply != "" {
+			return errReply, nil
+		}
+		reply := arrayReply{}
+		if st == nil {
+			return reply, nil
+		}
+		for n := range st.entries {
+			if count >= 0 && len(reply) >= count {
+				break
+			}
+			e := st.entries[n]
+			if reverse {
+				e = st.entries[len(st.entries)-1-n]
+			}
+			if !start.after(e.id) || !end.before(e.id) {
+				continue
+			}
+			reply = append(reply, arrayReply{e.id.String(), e.fields})
+		}
+		return reply, nil
+	}
+}
@@ -0,0 +1,277 @@
+package memredis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zset is a sorted set; ordering is computed on read, which is fine at the
+// sizes a test backplane sees.
+type zset struct {
+	scores map[string]float64
+}
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+func (z *zset) sorted() []zmember {
+	members := make([]zmember, 0, len(z.scores))
+	for member, score := range z.scores {
+		members = append(members, zmember{member: member, score: score})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+// scoreBound is one end of a ZRANGEBYSCORE interval.
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(raw string) (scoreBound, bool) {
+	bound := scoreBound{}
+	if strings.HasPrefix(raw, "(") {
+		bound.exclusive = true
+		raw = raw[1:]
+	}
+	switch strings.ToLower(raw) {
+	case "-inf":
+		bound.value = math.Inf(-1)
+	case "+inf", "inf":
+		bound.value = math.Inf(1)
+	default:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return bound, false
+		}
+		bound.value = value
+	}
+	return bound, true
+}
+
+func (b scoreBound) above(score float64) bool {
+	if b.exclusive {
+		return score > b.value
+	}
+	return score >= b.value
+}
+
+func (b scoreBound) below(score float64) bool {
+	if b.exclusive {
+		return score < b.value
+	}
+	return score <= b.value
+}
+
+// zsetAt returns the sorted set at key, creating it when create is set.
+func (s *Server) zsetAt(key string, create bool) (*zset, errorReply) {
+	e := s.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, ""
+		}
+		z := &zset{scores: make(map[string]float64)}
+		s.entries[key] = &entry{value: z}
+		return z, ""
+	}
+	z, ok := e.value.(*zset)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, ""
+}
+
+// removeIfEmpty deletes an emptied sorted set like Redis does.
+func (s *Server) removeIfEmpty(key string, z *zset) {
+	if z != nil && len(z.scores) == 0 {
+		delete(s.entries, key)
+	}
+}
+
+func cmdZAdd(s *Server, _ *conn, args []string) (any, []push) {
+	if (len(args)-2)%2 != 0 {
+		return errSyntax, nil
+	}
+	z, errReply := s.zsetAt(args[1], true)
+	if errReply != "" {
+		return errReply, nil
+	}
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return errorReply("ERR value is not a valid float"), nil
+		}
+		if _, ok := z.scores[args[i+1]]; !ok {
+			added++
+		}
+		z.scores[args[i+1]] = score
+	}
+	return added, nil
+}
+
+func cmdZRem(s *Server, _ *conn, args []string) (any, []push) {
+	z, errReply := s.zsetAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if z == nil {
+		return 0, nil
+	}
+	removed := 0
+	for _, member := range args[2:] {
+		if _, ok := z.scores[member]; ok {
+			delete(z.scores, member)
+			removed++
+		}
+	}
+	s.removeIfEmpty(args[1], z)
+	return removed, nil
+}
+
+func cmdZCard(s *Server, _ *conn, args []string) (any, []push) {
+	z, errReply := s.zsetAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if z == nil {
+		return 0, nil
+	}
+	return len(z.scores), nil
+}
+
+// cmdZRangeByScore supports WITHSCORES and LIMIT offset count.
+func cmdZRangeByScore(s *Server, _ *conn, args []string) (any, []push) {
+	min, okMin := parseScoreBound(args[2])
+	max, okMax := parseScoreBound(args[3])
+	if !okMin || !okMax {
+		return errorReply("ERR min or max is not a float"), nil
+	}
+	withScores := false
+	offset, count := 0, -1
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax, nil
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return errNotInt, nil
+			}
+			i += 2
+		default:
+			return errSyntax, nil
+		}
+	}
+	z, errReply := s.zsetAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	reply := make([]string, 0)
+	if z == nil {
+		return reply, nil
+	}
+	skipped, taken := 0, 0
+	for _, m := range z.sorted() {
+		if !min.above(m.score) || !max.below(m.score) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if count >= 0 && taken >= count {
+			break
+		}
+		taken++
+		reply = append(reply, m.member)
+		if withScores {
+			reply = append(reply, strconv.FormatFloat(m.score, 'f', -1, 64))
+		}
+	}
+	return reply, nil
+}
+
+func cmdZRemRangeByScore(s *Server, _ *conn, args []string) (any, []push) {
+	min, okMin := parseScoreBound(args[2])
+	max, okMax := parseScoreBound(args[3])
+	if !okMin || !okMax {
+		return errorReply("ERR min or max is not a float"), nil
+	}
+	z, errReply := s.zsetAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if z == nil {
+		return 0, nil
+	}
+	removed := 0
+	for member, score := range z.scores {
+		if min.above(score) && max.below(score) {
+			delete(z.scores, member)
+			removed++
+		}
+	}
+	s.removeIfEmpty(args[1], z)
+	return removed, nil
+}
+
+func cmdZRemRangeByRank(s *Server, _ *conn, args []string) (any, []push) {
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		return errNotInt, nil
+	}
+	z, errReply := s.zsetAt(args[1], false)
+	if errReply != "" {
+		return errReply, nil
+	}
+	if z == nil {
+		return 0, nil
+	}
+	members := z.sorted()
+	start, stop, ok := clampRange(start, stop, len(members))
+	if !ok {
+		return 0, nil
+	}
+	for _, m := range members[start : stop+1] {
+		delete(z.scores, m.member)
+	}
+	s.removeIfEmpty(args[1], z)
+	return stop - start + 1, nil
+}
+
+// clampRange resolves Redis-style inclusive, possibly negative indexes.
+func clampRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
@@ -0,0 +1,489 @@
+// Package schema validates JSON values against a subset of JSON Schema,
+// enough to describe chat-style frames without a third-party dependency.
+//
+// Supported keywords: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, allOf,
+// anyOf, oneOf and not. Annotations such as title and description are
+// ignored; any other keyword (notably $ref) is a compile error so a schema
+// never silently checks less than its author expects.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrors bounds how many problems one validation reports.
+const maxErrors = 20
+
+// annotations are accepted and ignored.
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true, "format": true,
+}
+
+// Error is one validation failure. Path is a JSON pointer into the value.
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled schema.
+type Schema struct {
+	types      []string
+	enum       []any
+	constant   *any
+	properties map[string]*Schema
+	required   []string
+	// additional is nil when unconstrained; noAdditional forbids extras.
+	additional   *Schema
+	noAdditional bool
+	items        *Schema
+	minItems     *int
+	maxItems     *int
+	minLength    *int
+	maxLength    *int
+	pattern      *regexp.Regexp
+	minimum      *float64
+	maximum      *float64
+	exclMinimum  *float64
+	exclMaximum  *float64
+	allOf        []*Schema
+	anyOf        []*Schema
+	oneOf        []*Schema
+	not          *Schema
+}
+
+// Compile parses a schema document.
+func Compile(doc []byte) (*Schema, error) {
+	var raw any
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return compile(raw, "")
+}
+
+func compile(raw any, at string) (*Schema, error) {
+	switch v := raw.(type) {
+	case bool:
+		if v {
+			return &Schema{}, nil
+		}
+		return &Schema{not: &Schema{}}, nil
+	case map[string]any:
+		s := &Schema{}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := s.keyword(key, v[key], at+"/"+key); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("schema %q: must be an object or boolean", at)
+	}
+}
+
+// keyword compiles one keyword of an object schema.
+func (s *Schema) keyword(key string, value any, at string) error {
+	bad := func(want string) error {
+		return fmt.Errorf("schema %s: must be %s", at, want)
+	}
+	var err error
+	switch key {
+	case "type":
+		switch t := value.(type) {
+		case string:
+			s.types = []string{t}
+		case []any:
+			for _, item := range t {
+				name, ok := item.(string)
+				if !ok {
+					return bad("a string or array of strings")
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return bad("a string or array of strings")
+		}
+		for _, name := range s.types {
+			switch name {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return fmt.Errorf("schema %s: unknown type %q", at, name)
+			}
+		}
+	case "enum":
+		values, ok := value.([]any)
+		if !ok {
+			return bad("an array")
+		}
+		for _, item := range values {
+			s.enum = append(s.enum, normalize(item))
+		}
+	case "const":
+		c := normalize(value)
+		s.constant = &c
+	case "properties":
+		props, ok := value.(map[string]any)
+		if !ok {
+			return bad("an object")
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, sub := range props {
+			if s.properties[name], err = compile(sub, at+"/"+escape(name)); err != nil {
+				return err
+			}
+		}
+	case "required":
+		names, ok := value.([]any)
+		if !ok {
+			return bad("an array of strings")
+		}
+		for _, item := range names {
+			name, ok := item.(string)
+			if !ok {
+				return bad("an array of strings")
+			}
+			s.required = append(s.required, name)
+		}
+	case "additionalProperties":
+		if allowed, ok := value.(bool); ok {
+			s.noAdditional = !allowed
+			return nil
+		}
+		s.additional, err = compile(value, at)
+	case "items":
+		s.items, err = compile(value, at)
+	case "minItems":
+		s.minItems, err = count(value, at)
+	case "maxItems":
+		s.maxItems, err = count(value, at)
+	case "minLength":
+		s.minLength, err = count(value, at)
+	case "maxLength":
+		s.maxLength, err = count(value, at)
+	case "pattern":
+		expr, ok := value.(string)
+		if !ok {
+			return bad("a string")
+		}
+		if s.pattern, err = regexp.Compile(expr); err != nil {
+			return fmt.Errorf("schema %s: %w", at, err)
+		}
+	case "minimum":
+		s.minimum, err = number(value, at)
+	case "maximum":
+		s.maximum, err = number(value, at)
+	case "exclusiveMinimum":
+		s.exclMinimum, err = number(value, at)
+	case "exclusiveMaximum":
+		s.exclMaximum, err = number(value, at)
+	case "allOf":
+		s.allOf, err = compileList(value, at)
+	case "anyOf":
+		s.anyOf, err = compileList(value, at)
+	case "oneOf":
+		s.oneOf, err = compileList(value, at)
+	case "not":
+		s.not, err = compile(value, at)
+	default:
+		if !annotations[key] {
+			return fmt.Errorf("schema %s: unsupported keyword %q", at, key)
+		}
+	}
+	return err
+}
+
+func compileList(value any, at string) ([]*Schema, error) {
+	items, ok := value.([]any)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("schema %s: must be a non-empty array", at)
+	}
+	out := make([]*Schema, len(items))
+	for i, item := range items {
+		var err error
+		if out[i], err = compile(item, at+"/"+strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func count(value any, at string) (*int, error) {
+	n, err := number(value, at)
+	if err != nil || *n < 0 || *n != math.Trunc(*n) {
+		return nil, fmt.Errorf("schema %s: must be a non-negative integer", at)
+	}
+	i := int(*n)
+	return &i, nil
+}
+
+func number(value any, at string) (*float64, error) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("schema %s: must be a number", at)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", at, err)
+	}
+	return &f, nil
+}
+
+// ValidateJSON decodes data and validates it. A decode failure is reported
+// as a single error at the root.
+func (s *Schema) ValidateJSON(data []byte) []Error {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []Error{{Message: "invalid JSON: " + err.Error()}}
+	}
+	return s.Validate(value)
+}
+
+// Validate checks a value decoded with encoding/json (numbers as float64 or
+// json.Number) and returns the problems found, nil when it is valid.
+func (s *Schema) Validate(value any) []Error {
+	var errs []Error
+	s.validate(normalize(value), "", &errs)
+	return errs
+}
+
+func (s *Schema) validate(value any, path string, errs *[]Error) {
+	if len(*errs) >= maxErrors {
+		return
+	}
+	fail := func(format string, args ...any) {
+		if len(*errs) < maxErrors {
+			*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if len(s.types) > 0 && !s.hasType(value) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+	if s.constant != nil && !equal(value, *s.constant) {
+		fail("must equal %s", encode(*s.constant))
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, option := range s.enum {
+			found = found || equal(value, option)
+		}
+		if !found {
+			fail("must be one of %s", encode(s.enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "/" + escape(name)
+			if sub, ok := s.properties[name]; ok {
+				sub.validate(v[name], child, errs)
+				continue
+			}
+			switch {
+			case s.noAdditional:
+				fail("property %q is not allowed", name)
+			case s.additional != nil:
+				s.additional.validate(v[name], child, errs)
+			}
+		}
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclMinimum != nil && v <= *s.exclMinimum {
+			fail("must be > %v", *s.exclMinimum)
+		}
+		if s.exclMaximum != nil && v >= *s.exclMaximum {
+			fail("must be < %v", *s.exclMaximum)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(value, path, errs)
+	}
+	if len(s.anyOf) > 0 && s.matching(s.anyOf, value) == 0 {
+		fail("must match at least one schema in anyOf")
+	}
+	if len(s.oneOf) > 0 {
+		if n := s.matching(s.oneOf, value); n != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if s.not != nil && s.not.valid(value) {
+		fail("must not match the schema in not")
+	}
+}
+
+func (s *Schema) valid(value any) bool {
+	var errs []Error
+	s.validate(value, "", &errs)
+	return len(errs) == 0
+}
+
+func (s *Schema) matching(options []*Schema, value any) int {
+	n := 0
+	for _, option := range options {
+		if option.valid(value) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Schema) hasType(value any) bool {
+	actual := typeOf(value)
+	for _, want := range s.types {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// normalize converts json.Number to float64 throughout a decoded value so
+// comparisons need only handle one numeric type.
+func normalize(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, item := range v {
+			out[key] = normalize(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalize(item)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+func equal(a, b any) bool {
+	return encode(a) == encode(b)
+}
+
+func encode(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// escape encodes a property name as a JSON pointer token.
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// LoadDir compiles every *.json file in dir, keyed by file name without the
+// extension.
+func LoadDir(dir string) (map[string]*Schema, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*Schema, len(paths))
+	for _, path := range paths {
+		doc, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := Compile(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		schemas[strings.TrimSuffix(filepath.Base(path), ".json")] = compiled
+	}
+	return schemas, nil
+}
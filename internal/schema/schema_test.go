@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const chat = `{
+	"title": "chat message",
+	"type": "object",
+	"required": ["type", "text"],
+	"additionalProperties": false,
+	"properties": {
+		"type": {"const": "chat"},
+		"id": {"type": "string"},
+		"text": {"type": "string", "minLength": 1, "maxLength": 10},
+		"priority": {"type": "integer", "minimum": 0, "maximum": 3},
+		"tags": {"type": "array", "maxItems": 2, "items": {"enum": ["a", "b"]}},
+		"to": {"oneOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(chat))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cases := []struct {
+		frame string
+		want  []string
+	}{
+		{`{"type":"chat","text":"hi","priority":2,"tags":["a"],"to":["x"]}`, nil},
+		{`{"type":"chat"}`, []string{`: missing required property "text"`}},
+		{`{"type":"chat","text":""}`, []string{"/text: must be at least 1 characters"}},
+		{`{"type":"chat","text":"hi","priority":1.5}`, []string{"/priority: expected integer, got number"}},
+		{`{"type":"chat","text":"hi","priority":7}`, []string{"/priority: must be <= 3"}},
+		{`{"type":"chat","text":"hi","tags":["a","c","b"]}`, []string{"/tags: must have at most 2 items", `/tags/1: must be one of ["a","b"]`}},
+		{`{"type":"chat","text":"hi","extra":1}`, []string{`: property "extra" is not allowed`}},
+		{`{"type":"chat","text":"hi","to":5}`, []string{"/to: must match exactly one schema in oneOf, matched 0"}},
+		{`{"type":"chat","text":`, []string{": invalid JSON: unexpected EOF"}},
+	}
+	for _, tc := range cases {
+		var got []string
+		for _, e := range s.ValidateJSON([]byte(tc.frame)) {
+			got = append(got, e.Path+": "+e.Message)
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s\n got %q\nwant %q", tc.frame, got, tc.want)
+		}
+	}
+}
+
+func TestCompileRejectsUnsupportedKeywords(t *testing.T) {
+	for _, doc := range []string{
+		`{"$ref": "#/definitions/x"}`,
+		`{"type": "thing"}`,
+		`{"properties": {"a": {"minLength": -1}}}`,
+		`{"pattern": "("}`,
+	} {
+		if _, err := Compile([]byte(doc)); err == nil {
+			t.Errorf("Compile(%s) succeeded, want error", doc)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Package webhook forwards hub events (connect, disconnect, inbound client
+// messages) to external HTTP endpoints.
+//
+// Deliveries are signed with HMAC-SHA256, retried with exponential backoff
+// on network errors, 429 and 5xx responses, and buffered in a bounded queue.
+// Events that cannot be delivered are written to a dead-letter log as JSON
+// lines so they can be replayed by hand.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-playground/internal/ws"
+)
+
+// Event types sent to webhooks.
+const (
+	EventConnect    = "connect"
+	EventDisconnect = "disconnect"
+	EventMessage    = "message"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+)
+
+// Config describes where and how events are delivered.
+type Config struct {
+	URLs []string
+	// Secret signs each body; receivers check it with Verify. It is
+	// required whenever URLs are set.
+	Secret string
+	// Events limits forwarding to these types; empty means all.
+	Events []string
+	// Node identifies this server in event bodies.
+	Node string
+	// Timeout bounds each HTTP attempt.
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// Backoff is the first retry delay; it doubles up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// QueueSize bounds pending events; overflow goes to the dead-letter log.
+	QueueSize int
+	// Workers is the number of concurrent senders.
+	Workers int
+	// DeadLetter receives undeliverable events; nil logs them instead.
+	DeadLetter io.Writer
+}
+
+// DefaultConfig returns the delivery defaults without any URLs.
+func DefaultConfig() Config {
+	node, _ := os.Hostname()
+	return Config{
+		Node:       node,
+		Timeout:    5 * time.Second,
+		MaxRetries: 3,
+		Backoff:    200 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		QueueSize:  1024,
+		Workers:    4,
+	}
+}
+
+// ConfigFromEnv reads WEBHOOK_* variables on top of DefaultConfig. The
+// returned closer releases a dead-letter file opened from WEBHOOK_DEAD_LETTER.
+func ConfigFromEnv() (Config, func() error, error) {
+	closer := func() error { return nil }
+	cfg, err := parseEnv()
+	if err != nil {
+		return cfg, closer, err
+	}
+	if path := os.Getenv("WEBHOOK_DEAD_LETTER"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return cfg, closer, fmt.Errorf("open WEBHOOK_DEAD_LETTER: %w", err)
+		}
+		cfg.DeadLetter = file
+		closer = file.Close
+	}
+	return cfg, closer, cfg.Validate()
+}
+
+// CheckEnv validates the WEBHOOK_* variables like ConfigFromEnv without
+// creating or opening anything: WEBHOOK_DEAD_LETTER must name an existing
+// file or a new one in an existing directory.
+func CheckEnv() (Config, error) {
+	cfg, err := parseEnv()
+	if err != nil {
+		return cfg, err
+	}
+	if path := os.Getenv("WEBHOOK_DEAD_LETTER"); path != "" {
+		if err := checkDeadLetterPath(path); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// parseEnv reads every WEBHOOK_* variable except the dead-letter path.
+func parseEnv() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.URLs = splitEnv("WEBHOOK_URLS")
+	cfg.Events = splitEnv("WEBHOOK_EVENTS")
+	cfg.Secret = os.Getenv("WEBHOOK_SECRET")
+	if raw := os.Getenv("WEBHOOK_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid WEBHOOK_TIMEOUT %q", raw)
+		}
+		cfg.Timeout = d
+	}
+	for name, target := range map[string]*int{
+		"WEBHOOK_MAX_RETRIES": &cfg.MaxRetries,
+		"WEBHOOK_QUEUE_SIZE":  &cfg.QueueSize,
+		"WEBHOOK_WORKERS":     &cfg.Workers,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*target = n
+		}
+	}
+	return cfg, nil
+}
+
+// checkDeadLetterPath stats path and, when it does not exist yet, its
+// parent directory.
+func checkDeadLetterPath(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("WEBHOOK_DEAD_LETTER %s is a directory", path)
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("WEBHOOK_DEAD_LETTER: %w", err)
+	}
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("WEBHOOK_DEAD_LETTER directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("WEBHOOK_DEAD_LETTER directory %s is not a directory", dir)
+	}
+	return nil
+}
+
+// Validate reports configuration mistakes.
+func (c Config) Validate() error {
+	for _, raw := range c.URLs {
+		if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
+			return fmt.Errorf("webhook: invalid url %q", raw)
+		}
+	}
+	if len(c.URLs) > 0 && c.Secret == "" {
+		return errors.New("webhook: WEBHOOK_SECRET is required to sign deliveries")
+	}
+	for _, event := range c.Events {
+		switch event {
+		case EventConnect, EventDisconnect, EventMessage:
+		default:
+			return fmt.Errorf("webhook: unknown event %q", event)
+		}
+	}
+	if c.Workers <= 0 || c.QueueSize <= 0 {
+		return errors.New("webhook: workers and queue size must be positive")
+	}
+	return nil
+}
+
+func splitEnv(name string) []string {
+	var values []string
+	for _, part := range strings.Split(os.Getenv(name), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// Event is the JSON body posted to webhooks.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Node    string    `json:"node,omitempty"`
+	UserID  string    `json:"user_id"`
+	Group   string    `json:"group"`
+	Payload string    `json:"payload,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// deadLetter is one line of the dead-letter log.
+type deadLetter struct {
+	Event    Event     `json:"event"`
+	URL      string    `json:"url,omitempty"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	At       time.Time `json:"at"`
+}
+
+// Forwarder queues events and delivers them in the background.
+type Forwarder struct {
+	cfg    Config
+	client *http.Client
+	queue  chan Event
+	quit   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	dlMu   sync.Mutex
+	seq    uint64
+}
+
+// New starts a forwarder with cfg.Workers senders.
+func New(cfg Config) (*Forwarder, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	f := &Forwarder{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Event, cfg.QueueSize),
+		quit:   make(chan struct{}),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		f.wg.Add(1)
+		go f.worker()
+	}
+	return f, nil
+}
+
+// HubOptions registers the hub hooks that feed the forwarder.
+func (f *Forwarder) HubOptions() []ws.Option {
+	return []ws.Option{
+		ws.OnConnect(func(c *ws.Client) {
+			f.Enqueue(Event{Type: EventConnect, UserID: c.UserID(), Group: c.Group()})
+		}),
+		ws.OnDisconnect(func(c *ws.Client, reason ws.DisconnectReason) {
+			f.Enqueue(Event{Type: EventDisconnect, UserID: c.UserID(), Group: c.Group(), Reason: string(reason)})
+		}),
+		ws.OnMessage(func(c *ws.Client, payload []byte) {
+			f.Enqueue(Event{Type: EventMessage, UserID: c.UserID(), Group: c.Group(), Payload: string(payload)})
+		}),
+	}
+}
+
+// Enqueue stamps and queues an event without blocking. Filtered events are
+// ignored; a full queue sends the event to the dead-letter log.
+func (f *Forwarder) Enqueue(event Event) {
+	if !f.wants(event.Type) {
+		return
+	}
+	// The dead-letter write happens after unlocking so a slow log never
+	// blocks other hook callers.
+	if event, err := f.enqueue(event); err != nil {
+		f.deadLetter(event, "", err, 0)
+	}
+}
+
+// enqueue stamps and queues an event under f.mu, returning the stamped event
+// and why it was not queued.
+func (f *Forwarder) enqueue(event Event) (Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	if event.ID == "" {
+		event.ID = fmt.Sprintf("%d-%d", time.Now().UnixNano(), f.seq)
+	}
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+	if event.Node == "" {
+		event.Node = f.cfg.Node
+	}
+	if f.closed {
+		return event, errors.New("forwarder closed")
+	}
+	select {
+	case f.queue <- event:
+		return event, nil
+	default:
+		return event, errors.New("queue full")
+	}
+}
+
+func (f *Forwarder) wants(eventType string) bool {
+	if len(f.cfg.URLs) == 0 {
+		return false
+	}
+	if len(f.cfg.Events) == 0 {
+		return true
+	}
+	for _, want := range f.cfg.Events {
+		if want == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops accepting events, delivers what is queued and waits for the
+// workers. Retries still pending at shutdown go to the dead-letter log.
+func (f *Forwarder) Close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	close(f.quit)
+	close(f.queue)
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+func (f *Forwarder) worker() {
+	defer f.wg.Done()
+	for event := range f.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			f.deadLetter(event, "", err, 0)
+			continue
+		}
+		for _, url := range f.cfg.URLs {
+			f.deliver(event, url, body)
+		}
+	}
+}
+
+// deliver posts body to url, retrying transient failures with backoff.
+func (f *Forwarder) deliver(event Event, url string, body []byte) {
+	backoff := f.cfg.Backoff
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		var retry bool
+		if retry, err = f.post(event, url, body); err == nil || !retry || attempts > f.cfg.MaxRetries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-f.quit:
+			err = fmt.Errorf("shutdown before retry: %w", err)
+			f.deadLetter(event, url, err, attempts)
+			return
+		}
+		backoff *= 2
+		if f.cfg.MaxBackoff > 0 && backoff > f.cfg.MaxBackoff {
+			backoff = f.cfg.MaxBackoff
+		}
+	}
+	if err != nil {
+		f.deadLetter(event, url, err, attempts)
+	}
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (f *Forwarder) post(event Event, url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(f.cfg.Secret, timestamp, body))
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook responded %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+}
+
+func (f *Forwarder) deadLetter(event Event, url string, err error, attempts int) {
+	line, _ := json.Marshal(deadLetter{Event: event, URL: url, Error: err.Error(), Attempts: attempts, At: time.Now().UTC()})
+	if f.cfg.DeadLetter == nil {
+		log.Printf("webhook dead letter: %s", line)
+		return
+	}
+	f.dlMu.Lock()
+	defer f.dlMu.Unlock()
+	_, _ = f.cfg.DeadLetter.Write(append(line, '\n'))
+}
+
+// Sign returns the signature header value for a timestamp and body:
+// "sha256=" followed by the hex HMAC-SHA256 of "timestamp.body".
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature in constant time; receivers should
+// also reject stale timestamps.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,213 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-playground/internal/httpserver"
+	"go-playground/internal/webhook"
+	"go-playground/internal/wstest"
+)
+
+// receiver records verified events and fails the first failures requests.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	failures atomic.Int32
+	status   int
+	events   chan webhook.Event
+}
+
+func newReceiver(t *testing.T, secret string) (*receiver, *httptest.Server) {
+	r := &receiver{t: t, secret: secret, status: http.StatusServiceUnavailable, events: make(chan webhook.Event, 16)}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if !webhook.Verify(r.secret, req.Header.Get(webhook.HeaderTimestamp), body, req.Header.Get(webhook.HeaderSignature)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.failures.Add(-1) >= 0 {
+		w.WriteHeader(r.status)
+		return
+	}
+	var event webhook.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("decode event: %v", err)
+	}
+	r.events <- event
+}
+
+func (r *receiver) expect(t *testing.T, eventType, userID string) webhook.Event {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		if event.Type != eventType || event.UserID != userID {
+			t.Fatalf("event = %+v, want %s for %s", event, eventType, userID)
+		}
+		return event
+	case <-time.After(wstest.DefaultTimeout):
+		t.Fatalf("no %s event for %s", eventType, userID)
+		return webhook.Event{}
+	}
+}
+
+// syncBuffer is a dead-letter sink safe for concurrent writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func testConfig(urls ...string) webhook.Config {
+	cfg := webhook.DefaultConfig()
+	cfg.URLs = urls
+	cfg.Secret = "s3cret"
+	cfg.Backoff = 10 * time.Millisecond
+	cfg.MaxBackoff = 20 * time.Millisecond
+	return cfg
+}
+
+func TestForwardsHubEventsWithRetries(t *testing.T) {
+	recv, server := newReceiver(t, "s3cret")
+	// The first two deliveries fail with 503 and must be retried.
+	recv.failures.Store(2)
+	forwarder, err := webhook.New(testConfig(server.URL))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer forwarder.Close()
+
+	cluster := wstest.NewCluster(t, 1, httpserver.WithHubOptions(forwarder.HubOptions()...))
+	client := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	recv.expect(t, webhook.EventConnect, "alpha")
+
+	client.Send(t, "hello")
+	if event := recv.expect(t, webhook.EventMessage, "alpha"); event.Payload != "hello" || event.Group != "team" {
+		t.Fatalf("message event = %+v", event)
+	}
+
+	client.Close()
+	if event := recv.expect(t, webhook.EventDisconnect, "alpha"); event.Reason != "closed" {
+		t.Fatalf("disconnect reason = %q", event.Reason)
+	}
+}
+
+func TestDeadLettersPermanentFailures(t *testing.T) {
+	recv, server := newReceiver(t, "s3cret")
+	recv.status = http.StatusBadRequest
+	recv.failures.Store(100)
+	var dead syncBuffer
+	cfg := testConfig(server.URL)
+	cfg.DeadLetter = &dead
+	forwarder, err := webhook.New(cfg)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	forwarder.Enqueue(webhook.Event{Type: webhook.EventMessage, UserID: "alpha"})
+	forwarder.Close()
+
+	// A 400 is not retried: one attempt, then the dead-letter log.
+	line := strings.TrimSpace(dead.String())
+	var entry struct {
+		Event    webhook.Event `json:"event"`
+		Attempts int           `json:"attempts"`
+		Error    string        `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("dead letter %q: %v", line, err)
+	}
+	if entry.Event.UserID != "alpha" || entry.Attempts != 1 || !strings.Contains(entry.Error, "400") {
+		t.Fatalf("dead letter = %+v", entry)
+	}
+}
+
+func TestFullQueueDeadLetters(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	var dead syncBuffer
+	cfg := testConfig(server.URL)
+	cfg.Workers = 1
+	cfg.QueueSize = 1
+	cfg.DeadLetter = &dead
+	forwarder, err := webhook.New(cfg)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	// One event is in flight, one is queued, the rest overflow.
+	for i := 0; i < 5; i++ {
+		forwarder.Enqueue(webhook.Event{Type: webhook.EventConnect, UserID: "alpha"})
+	}
+	deadline := time.Now().Add(wstest.DefaultTimeout)
+	for strings.Count(dead.String(), "queue full") < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters = %q, want 3 queue full entries", dead.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestValidateRequiresSecret(t *testing.T) {
+	cfg := testConfig("http://hooks.example")
+	cfg.Secret = ""
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET") {
+		t.Fatalf("validate without secret = %v, want WEBHOOK_SECRET error", err)
+	}
+	cfg.URLs = nil
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate without urls = %v", err)
+	}
+}
+
+func TestCheckEnvCreatesNothing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dead.jsonl")
+	t.Setenv("WEBHOOK_DEAD_LETTER", path)
+	if _, err := webhook.CheckEnv(); err != nil {
+		t.Fatalf("check with new dead-letter file = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("check created %s (stat err %v)", path, err)
+	}
+
+	t.Setenv("WEBHOOK_DEAD_LETTER", filepath.Join(dir, "missing", "dead.jsonl"))
+	if _, err := webhook.CheckEnv(); err == nil {
+		t.Fatal("check accepted a dead-letter file in a missing directory")
+	}
+	t.Setenv("WEBHOOK_DEAD_LETTER", dir)
+	if _, err := webhook.CheckEnv(); err == nil {
+		t.Fatal("check accepted a directory as the dead-letter file")
+	}
+}
@@ -0,0 +1,199 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+)
+
+// DefaultGroupPolicy is the ACL key whose policy applies to groups without
+// one of their own.
+const DefaultGroupPolicy = "*"
+
+var (
+	// ErrJoinDenied is returned when a group's policy does not admit the user.
+	ErrJoinDenied = errors.New("join denied")
+	// ErrGroupFull is returned when a group is at its member limit.
+	ErrGroupFull = errors.New("group full")
+	// ErrPublishDenied is returned when a member may not send to its group.
+	ErrPublishDenied = errors.New("publish denied")
+)
+
+// GroupPolicy restricts who may join and send to a group. The zero value
+// allows everything.
+type GroupPolicy struct {
+	// Join lists the user ids admitted; empty admits anyone.
+	Join []string `json:"join,omitempty"`
+	// Publish lists the members whose frames are broadcast; empty allows
+	// every member.
+	Publish []string `json:"publish,omitempty"`
+	// ReadOnly stops all client frames; the HTTP send APIs still reach it.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// MaxMembers caps the group's connections across the cluster, or on
+	// this node when Redis is unavailable; 0 is unlimited.
+	MaxMembers int `json:"max_members,omitempty"`
+}
+
+// Validate rejects policies that cannot be enforced.
+func (p GroupPolicy) Validate() error {
+	if p.MaxMembers < 0 {
+		return fmt.Errorf("max_members must not be negative, got %d", p.MaxMembers)
+	}
+	return nil
+}
+
+// ACL holds the group policies of one node. It is safe for concurrent use;
+// changes apply to new connections and to the next frame of existing ones.
+//
+// Policies implied by persisted groups, which the hub reloads from its
+// GroupStore on every node, take precedence over those set on the ACL,
+// which come from configuration.
+type ACL struct {
+	mu       sync.RWMutex
+	policies map[string]GroupPolicy
+	stored   map[string]GroupPolicy
+}
+
+// NewACL returns an ACL with the given policies keyed by group.
+func NewACL(policies map[string]GroupPolicy) (*ACL, error) {
+	acl := &ACL{policies: make(map[string]GroupPolicy, len(policies))}
+	for group, policy := range policies {
+		if err := acl.Set(group, policy); err != nil {
+			return nil, err
+		}
+	}
+	return acl, nil
+}
+
+// LoadACL reads a JSON object of group policies, for example
+//
+//	{"ops": {"join": ["alice", "bob"], "max_members": 10}, "news": {"read_only": true}}
+func LoadACL(path string) (*ACL, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies map[string]GroupPolicy
+	if err := json.Unmarshal(raw, &policies); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return NewACL(policies)
+}
+
+// Policy returns the persisted group's policy, falling back to the
+// configured one and then the default entry. The bool reports whether the
+// group has a policy of its own.
+func (a *ACL) Policy(group string) (GroupPolicy, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if policy, ok := a.stored[group]; ok {
+		return policy, true
+	}
+	if policy, ok := a.policies[group]; ok {
+		return policy, true
+	}
+	return a.policies[DefaultGroupPolicy], false
+}
+
+// Policies returns a copy of every configured policy.
+func (a *ACL) Policies() map[string]GroupPolicy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	out := make(map[string]GroupPolicy, len(a.policies))
+	for group, policy := range a.policies {
+		out[group] = policy
+	}
+	return out
+}
+
+// Set replaces the policy for group.
+func (a *ACL) Set(group string, policy GroupPolicy) error {
+	if group == "" {
+		return errors.New("group is required")
+	}
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("group %s: %w", group, err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policies[group] = policy
+	return nil
+}
+
+// Delete removes the policy for group and reports whether it existed.
+func (a *ACL) Delete(group string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.policies[group]
+	delete(a.policies, group)
+	return ok
+}
+
+// setStored replaces the policies implied by persisted groups.
+func (a *ACL) setStored(policies map[string]GroupPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stored = policies
+}
+
+// WithACL enforces acl on joins and inbound frames.
+func WithACL(acl *ACL) Option {
+	return func(h *Hub) {
+		h.acl = acl
+	}
+}
+
+// ACL returns the hub's configured group policies. The admin API edits
+// persisted groups instead, so its changes reach every node.
+func (h *Hub) ACL() *ACL {
+	return h.acl
+}
+
+// authorizeJoin checks a new connection against its group's policy.
+// Concurrent joins may briefly exceed MaxMembers by the number racing.
+func (h *Hub) authorizeJoin(ctx context.Context, userID, group string) error {
+	policy, _ := h.acl.Policy(group)
+	if len(policy.Join) > 0 && !slices.Contains(policy.Join, userID) {
+		return fmt.Errorf("%w: %s may not join %s", ErrJoinDenied, userID, group)
+	}
+	if policy.MaxMembers > 0 {
+		members := h.groupMembers(ctx, group)
+		if members >= policy.MaxMembers {
+			return fmt.Errorf("%w: %s has %d of %d members", ErrGroupFull, group, members, policy.MaxMembers)
+		}
+	}
+	return nil
+}
+
+// groupMembers counts a group's connections across the cluster from its
+// member set. Without Redis, or when Redis fails, the local count is used so
+// the cap still holds per node.
+func (h *Hub) groupMembers(ctx context.Context, group string) int {
+	if h.redis != nil {
+		count, err := h.liveSlots(ctx, memberSetPrefix+group)
+		if err == nil {
+			return int(count)
+		}
+		log.Printf("redis group members group=%s failed: %v", group, err)
+	}
+	members := 0
+	h.do(func() { members = len(h.clientsByGroup[group]) })
+	return members
+}
+
+// authorizePublish checks whether a member's frame may be broadcast.
+func (h *Hub) authorizePublish(c *Client) error {
+	policy, _ := h.acl.Policy(c.group)
+	if policy.ReadOnly {
+		return fmt.Errorf("%w: %s is read-only", ErrPublishDenied, c.group)
+	}
+	if len(policy.Publish) > 0 && !slices.Contains(policy.Publish, c.id) {
+		return fmt.Errorf("%w: %s may not publish to %s", ErrPublishDenied, c.id, c.group)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backend services call methods on a user's client with CallUser. The
+// request travels on the user's Redis channel, so whichever node holds the
+// user forwards it as
+//
+//	{"type":"rpc_call","id":"c1","method":"confirm","params":{...}}
+//
+// and the client answers on the same socket with
+//
+//	{"type":"rpc_reply","id":"c1","result":...}
+//	{"type":"rpc_reply","id":"c1","error":{"code":"denied","message":"..."}}
+//
+// The owning node publishes the reply on the caller's reply channel. When
+// the user has several connections every one is asked and the first reply
+// wins.
+
+const (
+	rpcCallType  = "rpc_call"
+	rpcReplyType = "rpc_reply"
+
+	// replyChannelPrefix namespaces each node's call reply channel.
+	replyChannelPrefix = "ws:rpc:reply:"
+	// replySubscription keys the PubSub that carries the reply channel.
+	replySubscription = "reply"
+	// DefaultCallTimeout bounds CallUser when ctx has no deadline.
+	DefaultCallTimeout = 10 * time.Second
+	// MaxCallTimeout caps a caller-chosen call timeout.
+	MaxCallTimeout = 60 * time.Second
+)
+
+var (
+	// ErrUserNotConnected is returned by CallUser when no node holds the user.
+	ErrUserNotConnected = errors.New("user not connected")
+	// ErrCallTimeout is returned by CallUser when no client replied in time.
+	ErrCallTimeout = errors.New("call timed out")
+)
+
+// callRequest is the cross-node form of a server-to-client call.
+type callRequest struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// ReplyTo is the caller's reply channel; empty means the caller is local.
+	ReplyTo  string    `json:"reply_to,omitempty"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// callReply is both the client frame and the reply channel payload.
+type callReply struct {
+	Type   string          `json:"type,omitempty"`
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// callRoute remembers where to send a forwarded call's reply.
+type callRoute struct {
+	userID   string
+	replyTo  string
+	deadline time.Time
+}
+
+// callTable tracks calls this node is waiting on and calls it forwarded.
+type callTable struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[string]chan callReply
+	routes  map[string]callRoute
+}
+
+// CallUser asks the user's client to run method and waits for its reply.
+// A client error is returned as *RPCError.
+func (h *Hub) CallUser(ctx context.Context, userID, method string, params json.RawMessage) (json.RawMessage, error) {
+	if userID == "" || method == "" {
+		return nil, errors.New("user id and method are required")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultCallTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	req := callRequest{Method: method, Params: params, ReplyTo: h.replyChannel, Deadline: deadline}
+	replies := make(chan callReply, 1)
+	h.calls.mu.Lock()
+	h.calls.seq++
+	req.ID = h.instanceID + "-" + strconv.FormatUint(h.calls.seq, 10)
+	if h.calls.pending == nil {
+		h.calls.pending = make(map[string]chan callReply)
+	}
+	h.calls.pending[req.ID] = replies
+	h.calls.mu.Unlock()
+	defer func() {
+		h.calls.mu.Lock()
+		delete(h.calls.pending, req.ID)
+		h.calls.mu.Unlock()
+	}()
+
+	if h.redis == nil {
+		if h.forwardCall(userID, req) == 0 {
+			return nil, ErrUserNotConnected
+		}
+	} else {
+		msg := broadcastMessage{id: req.ID, source: h.instanceID, sentAt: time.Now().UTC(), userID: userID, call: &req}
+		data, err := encodeEnvelope(msg)
+		if err != nil {
+			return nil, err
+		}
+		// The reply channel is subscribed at startup, so publishing first is safe.
+		receivers, err := h.publish(ctx, h.userChannel(userID), data)
+		if err != nil {
+			return nil, err
+		}
+		if receivers == 0 {
+			return nil, ErrUserNotConnected
+		}
+	}
+
+	select {
+	case reply := <-replies:
+		if reply.Error != nil {
+			return nil, reply.Error
+		}
+		return reply.Result, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrCallTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// forwardCall sends a call to the user's local connections and records the
+// reply route. It returns how many connections were asked.
+func (h *Hub) forwardCall(userID string, req callRequest) int {
+	frame, err := json.Marshal(rpcFrame{Type: rpcCallType, ID: req.ID, Method: req.Method, Params: req.Params})
+	if err != nil {
+		log.Printf("ws call %s not encodable: %v", req.ID, err)
+		return 0
+	}
+	h.routeCall(req.ID, callRoute{userID: userID, replyTo: req.ReplyTo, deadline: req.Deadline})
+	sent := 0
+	h.do(func() {
+		for client := range h.clientsByUser[userID] {
+			if h.trySend(client, frame) {
+				sent++
+			}
+		}
+	})
+	log.Printf("ws call forwarded id=%s user=%s method=%s connections=%d", req.ID, userID, req.Method, sent)
+	return sent
+}
+
+// routeCall stores a reply route and prunes routes whose caller gave up.
+func (h *Hub) routeCall(id string, route callRoute) {
+	now := time.Now()
+	h.calls.mu.Lock()
+	defer h.calls.mu.Unlock()
+	if h.calls.routes == nil {
+		h.calls.routes = make(map[string]callRoute)
+	}
+	for key, existing := range h.calls.routes {
+		if now.After(existing.deadline) {
+			delete(h.calls.routes, key)
+		}
+	}
+	h.calls.routes[id] = route
+}
+
+// parseCallReply reports whether frame is a client's rpc_reply.
+func parseCallReply(frame []byte) (callReply, bool) {
+	var reply callReply
+	trimmed := bytes.TrimSpace(frame)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"rpc_reply"`)) {
+		return reply, false
+	}
+	if json.Unmarshal(trimmed, &reply) != nil || reply.Type != rpcReplyType {
+		return reply, false
+	}
+	return reply, true
+}
+
+// handleCallReply routes a client's reply back to the caller. Replies to
+// unknown or expired calls, or from another user, are dropped.
+func (h *Hub) handleCallReply(c *Client, reply callReply) {
+	h.calls.mu.Lock()
+	route, ok := h.calls.routes[reply.ID]
+	if ok && route.userID == c.id {
+		// Later replies from the user's other connections are ignored.
+		delete(h.calls.routes, reply.ID)
+	}
+	h.calls.mu.Unlock()
+	if !ok || route.userID != c.id || time.Now().After(route.deadline) {
+		return
+	}
+	reply.Type = ""
+	if route.replyTo == "" || route.replyTo == h.replyChannel {
+		h.resolveCall(reply)
+		return
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("ws call %s reply not encodable: %v", reply.ID, err)
+		return
+	}
+	if _, err := h.publish(context.Background(), route.replyTo, data); err != nil {
+		log.Printf("redis call reply id=%s failed: %v", reply.ID, err)
+	}
+}
+
+// handleReplyMessage delivers a reply published by the owning node.
+func (h *Hub) handleReplyMessage(data string) {
+	var reply callReply
+	if err := json.Unmarshal([]byte(data), &reply); err != nil {
+		log.Printf("redis call reply decode failed: %v", err)
+		return
+	}
+	h.resolveCall(reply)
+}
+
+// resolveCall hands the first reply to the waiting CallUser.
+func (h *Hub) resolveCall(reply callReply) {
+	h.calls.mu.Lock()
+	replies, ok := h.calls.pending[reply.ID]
+	h.calls.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case replies <- reply:
+	default:
+	}
+}
@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// envelopeVersion is bumped whenever the wire format changes incompatibly.
+// Version 2 added the call, evict, sync and state control fields; older
+// nodes must reject those envelopes rather than deliver them as frames.
+const envelopeVersion = 2
+
+// plainEnvelopeVersion is written for messages without control fields, so
+// older nodes keep delivering ordinary traffic during a rolling deploy.
+const plainEnvelopeVersion = 1
+
+// envelope is the single cross-node wire format for both the broadcast
+// channel and per-user channels, so every route yields the same frame.
+type envelope struct {
+	Version  int               `json:"v"`
+	ID       string            `json:"id"`
+	Source   string            `json:"source"`
+	SentAt   time.Time         `json:"sent_at"`
+	Group    string            `json:"group,omitempty"`
+	Groups   []string          `json:"groups,omitempty"`
+	UserID   string            `json:"user_id,omitempty"`
+	Topic    string            `json:"topic,omitempty"`
+	All      bool              `json:"all,omitempty"`
+	Receipt  bool              `json:"receipt,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Call     *callRequest      `json:"call,omitempty"`
+	Evict    string            `json:"evict,omitempty"`
+	Sync     string            `json:"sync,omitempty"`
+	State    bool              `json:"state,omitempty"`
+	Payload  string            `json:"payload"`
+}
+
+// encodeEnvelope serializes a hub message for Redis.
+func encodeEnvelope(msg broadcastMessage) ([]byte, error) {
+	version := plainEnvelopeVersion
+	if msg.call != nil || msg.evict != "" || msg.sync != "" || msg.ephemeral {
+		version = envelopeVersion
+	}
+	return json.Marshal(envelope{
+		Version:  version,
+		ID:       msg.id,
+		Source:   msg.source,
+		SentAt:   msg.sentAt,
+		Group:    msg.group,
+		Groups:   msg.groups,
+		UserID:   msg.userID,
+		Topic:    msg.topic,
+		All:      msg.all,
+		Receipt:  msg.receipt,
+		Metadata: msg.metadata,
+		Call:     msg.call,
+		Evict:    msg.evict,
+		Sync:     msg.sync,
+		State:    msg.ephemeral,
+		Payload:  base64.StdEncoding.EncodeToString(msg.payload),
+	})
+}
+
+// decodeEnvelope parses a Redis message back into a hub message marked as remote.
+// Version 0 covers the pre-versioned broadcast format, which used the same fields.
+func decodeEnvelope(data []byte) (broadcastMessage, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return broadcastMessage{}, err
+	}
+	if env.Version > envelopeVersion {
+		return broadcastMessage{}, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return broadcastMessage{}, err
+	}
+	return broadcastMessage{
+		id:        env.ID,
+		source:    env.Source,
+		sentAt:    env.SentAt,
+		group:     env.Group,
+		groups:    env.Groups,
+		userID:    env.UserID,
+		topic:     env.Topic,
+		all:       env.All,
+		receipt:   env.Receipt,
+		metadata:  env.Metadata,
+		call:      env.Call,
+		evict:     env.Evict,
+		sync:      env.Sync,
+		ephemeral: env.State,
+		payload:   payload,
+		remote:    true,
+	}, nil
+}
+
+// newMessage stamps a locally originated message with an id and send time.
+func (h *Hub) newMessage(payload []byte) broadcastMessage {
+	return broadcastMessage{
+		id:      newNotificationID(),
+		source:  h.instanceID,
+		sentAt:  time.Now().UTC(),
+		payload: payload,
+	}
+}
+
+// debugFrame is what clients connected with ?debug=1 receive for every hub
+// message, whichever route it took, so a UI can label frames relayed
+// through Redis without the payload itself changing.
+type debugFrame struct {
+	Type   string `json:"type"`
+	Route  string `json:"route"`
+	Source string `json:"source"`
+	ID     string `json:"id,omitempty"`
+	Frame  string `json:"frame"`
+}
+
+// frameFor returns the bytes written to a client: the payload itself, or
+// the payload wrapped in a debugFrame for debug clients.
+func frameFor(client *Client, msg broadcastMessage) []byte {
+	if !client.debug {
+		return msg.payload
+	}
+	route := "local"
+	if msg.remote {
+		route = "redis"
+	}
+	data, err := json.Marshal(debugFrame{Type: "debug", Route: route, Source: msg.source, ID: msg.id, Frame: string(msg.payload)})
+	if err != nil {
+		return msg.payload
+	}
+	return data
+}
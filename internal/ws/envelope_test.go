@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	base := broadcastMessage{
+		id:       "n1",
+		source:   "node-a",
+		sentAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		group:    "team",
+		groups:   []string{"a", "b"},
+		userID:   "alice",
+		topic:    "news.*",
+		all:      true,
+		receipt:  true,
+		metadata: map[string]string{"k": "v"},
+		payload:  []byte(`{"type":"chat"}`),
+	}
+	cases := []struct {
+		name    string
+		edit    func(*broadcastMessage)
+		version int
+	}{
+		{"plain", func(*broadcastMessage) {}, plainEnvelopeVersion},
+		{"call", func(m *broadcastMessage) {
+			m.call = &callRequest{ID: "c1", Method: "sum", ReplyTo: "ws:reply:node-a", Deadline: base.sentAt.Add(time.Second)}
+		}, envelopeVersion},
+		{"evict", func(m *broadcastMessage) { m.evict = "conn-1" }, envelopeVersion},
+		{"sync", func(m *broadcastMessage) { m.sync = "groups" }, envelopeVersion},
+		{"state", func(m *broadcastMessage) { m.ephemeral = true }, envelopeVersion},
+	}
+	for _, tc := range cases {
+		msg := base
+		tc.edit(&msg)
+		data, err := encodeEnvelope(msg)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", tc.name, err)
+		}
+		var header struct {
+			Version int `json:"v"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil || header.Version != tc.version {
+			t.Fatalf("%s: version = %d, %v; want %d", tc.name, header.Version, err, tc.version)
+		}
+		got, err := decodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tc.name, err)
+		}
+		msg.remote = true
+		if !reflect.DeepEqual(got, msg) {
+			t.Fatalf("%s: round trip = %+v, want %+v", tc.name, got, msg)
+		}
+	}
+}
+
+func TestDecodeEnvelopeCompatibility(t *testing.T) {
+	// Pre-versioned broadcast payloads carried no "v" field.
+	legacy := `{"id":"n1","source":"node-a","sent_at":"2024-05-01T12:00:00Z","group":"team","payload":"aGk="}`
+	msg, err := decodeEnvelope([]byte(legacy))
+	if err != nil {
+		t.Fatalf("decode legacy: %v", err)
+	}
+	if msg.id != "n1" || msg.group != "team" || string(msg.payload) != "hi" || !msg.remote {
+		t.Fatalf("legacy = %+v", msg)
+	}
+
+	v1 := `{"v":1,"id":"n2","source":"node-a","sent_at":"2024-05-01T12:00:00Z","user_id":"alice","receipt":true,"payload":"aGk="}`
+	msg, err = decodeEnvelope([]byte(v1))
+	if err != nil {
+		t.Fatalf("decode v1: %v", err)
+	}
+	if msg.userID != "alice" || !msg.receipt || string(msg.payload) != "hi" {
+		t.Fatalf("v1 = %+v", msg)
+	}
+
+	if _, err := decodeEnvelope([]byte(`{"v":3,"payload":"aGk="}`)); err == nil || !strings.Contains(err.Error(), "unsupported envelope version 3") {
+		t.Fatalf("future version err = %v", err)
+	}
+	if _, err := decodeEnvelope([]byte(`{"v":1,"payload":"not base64!"}`)); err == nil {
+		t.Fatal("invalid payload accepted")
+	}
+}
@@ -0,0 +1,497 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// groupKeyPrefix namespaces one JSON document per persisted group. The
+	// {groups} hash tag keeps records and index in one cluster slot so they
+	// can change in a single transaction.
+	groupKeyPrefix = "ws:{groups}:group:"
+	// groupIndexKey lists persisted group ids scored by creation time.
+	groupIndexKey = "ws:{groups}:index"
+	// groupTxRetries bounds optimistic retries when concurrent writers
+	// touch the same group.
+	groupTxRetries = 16
+	// groupSyncInterval is how often nodes reload group policies as a
+	// backstop for missed change notifications.
+	groupSyncInterval = 30 * time.Second
+	// syncGroups is the broadcast sync signal sent after a group changes.
+	syncGroups = "groups"
+)
+
+var (
+	// ErrGroupNotFound is returned for ids without a persisted group.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupExists is returned when creating a group id already in use.
+	ErrGroupExists = errors.New("group already exists")
+	// ErrInvalidGroup wraps validation failures of a group record.
+	ErrInvalidGroup = errors.New("invalid group")
+)
+
+// Group is a persisted group. Connections still join by id with ?group=;
+// the record adds metadata and a policy that outlive any member being
+// online.
+type Group struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Owner     string            `json:"owner,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Settings  map[string]string `json:"settings,omitempty"`
+	// Members, when set, are the only users admitted unless Policy.Join
+	// says otherwise.
+	Members []string     `json:"members,omitempty"`
+	Policy  *GroupPolicy `json:"policy,omitempty"`
+}
+
+// Validate rejects groups that cannot be stored or enforced.
+func (g Group) Validate() error {
+	if g.ID == "" || strings.ContainsAny(g.ID, " /") {
+		return fmt.Errorf("%w: id %q", ErrInvalidGroup, g.ID)
+	}
+	if g.Policy != nil {
+		if err := g.Policy.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidGroup, err)
+		}
+	}
+	return nil
+}
+
+// policy returns the ACL entry the group implies, if any.
+func (g Group) policy() (GroupPolicy, bool) {
+	if g.Policy == nil && len(g.Members) == 0 {
+		return GroupPolicy{}, false
+	}
+	var policy GroupPolicy
+	if g.Policy != nil {
+		policy = *g.Policy
+	}
+	if len(policy.Join) == 0 {
+		policy.Join = g.Members
+	}
+	return policy, true
+}
+
+// GroupStore persists group records.
+type GroupStore interface {
+	// Create stores a new group and fails with ErrGroupExists.
+	Create(ctx context.Context, group Group) error
+	// Get returns one group or ErrGroupNotFound.
+	Get(ctx context.Context, id string) (Group, error)
+	// List returns every group, oldest first.
+	List(ctx context.Context) ([]Group, error)
+	// Modify applies edit to the stored group atomically and returns the
+	// result, or fails with ErrGroupNotFound.
+	Modify(ctx context.Context, id string, edit func(*Group) error) (Group, error)
+	// Delete removes a group or fails with ErrGroupNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// redisGroupStore keeps each group as a JSON string plus a sorted-set index.
+type redisGroupStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisGroupStore returns a group store shared by every node on client.
+func NewRedisGroupStore(client redis.UniversalClient) GroupStore {
+	return &redisGroupStore{client: client}
+}
+
+func (s *redisGroupStore) Create(ctx context.Context, group Group) error {
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	key := groupKeyPrefix + group.ID
+	return s.transact(ctx, key, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return fmt.Errorf("%w: %s", ErrGroupExists, group.ID)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			pipe.ZAdd(ctx, groupIndexKey, redis.Z{Score: float64(group.CreatedAt.UnixMilli()), Member: group.ID})
+			return nil
+		})
+		return err
+	})
+}
+
+func (s *redisGroupStore) Get(ctx context.Context, id string) (Group, error) {
+	return getGroup(ctx, s.client, id)
+}
+
+// getGroup reads one record through c, which may be a watching transaction.
+func getGroup(ctx context.Context, c redis.Cmdable, id string) (Group, error) {
+	data, err := c.Get(ctx, groupKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Group{}, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	if err != nil {
+		return Group{}, err
+	}
+	var group Group
+	err = json.Unmarshal(data, &group)
+	return group, err
+}
+
+func (s *redisGroupStore) List(ctx context.Context) ([]Group, error) {
+	ids, err := s.client.ZRangeByScore(ctx, groupIndexKey, &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		gets[i] = pipe.Get(ctx, groupKeyPrefix+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	groups := make([]Group, 0, len(ids))
+	for _, get := range gets {
+		var group Group
+		data, err := get.Bytes()
+		if err != nil || json.Unmarshal(data, &group) != nil {
+			// Deleted between the index read and the get.
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (s *redisGroupStore) Modify(ctx context.Context, id string, edit func(*Group) error) (Group, error) {
+	key := groupKeyPrefix + id
+	var out Group
+	err := s.transact(ctx, key, func(tx *redis.Tx) error {
+		group, err := getGroup(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := edit(&group); err != nil {
+			return err
+		}
+		data, err := json.Marshal(group)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		out = group
+		return err
+	})
+	return out, err
+}
+
+func (s *redisGroupStore) Delete(ctx context.Context, id string) error {
+	key := groupKeyPrefix + id
+	return s.transact(ctx, key, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, groupIndexKey, id)
+			return nil
+		})
+		return err
+	})
+}
+
+// transact runs fn with key watched, retrying while concurrent writes abort
+// the transaction.
+func (s *redisGroupStore) transact(ctx context.Context, key string, fn func(*redis.Tx) error) error {
+	for range groupTxRetries {
+		err := s.client.Watch(ctx, fn, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %w", key, redis.TxFailedErr)
+}
+
+// memoryGroupStore is the single-node fallback when Redis is unavailable.
+type memoryGroupStore struct {
+	mu     sync.Mutex
+	groups map[string]Group
+}
+
+// NewMemoryGroupStore returns a process-local store that is lost on restart.
+func NewMemoryGroupStore() GroupStore {
+	return &memoryGroupStore{groups: make(map[string]Group)}
+}
+
+func (s *memoryGroupStore) Create(_ context.Context, group Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[group.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrGroupExists, group.ID)
+	}
+	s.groups[group.ID] = group
+	return nil
+}
+
+func (s *memoryGroupStore) Get(_ context.Context, id string) (Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group, ok := s.groups[id]
+	if !ok {
+		return Group{}, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	return group, nil
+}
+
+func (s *memoryGroupStore) List(context.Context) ([]Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].CreatedAt.Before(groups[j].CreatedAt) })
+	return groups, nil
+}
+
+func (s *memoryGroupStore) Modify(_ context.Context, id string, edit func(*Group) error) (Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group, ok := s.groups[id]
+	if !ok {
+		return Group{}, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	group.Members = slices.Clone(group.Members)
+	if err := edit(&group); err != nil {
+		return Group{}, err
+	}
+	s.groups[id] = group
+	return group, nil
+}
+
+func (s *memoryGroupStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	delete(s.groups, id)
+	return nil
+}
+
+// CreateGroup persists a new group, defaulting its name to the id.
+func (h *Hub) CreateGroup(ctx context.Context, group Group) (Group, error) {
+	if err := group.Validate(); err != nil {
+		return Group{}, err
+	}
+	if group.Name == "" {
+		group.Name = group.ID
+	}
+	group.CreatedAt = time.Now().UTC()
+	group.UpdatedAt = group.CreatedAt
+	if err := h.groups.Create(ctx, group); err != nil {
+		return Group{}, err
+	}
+	h.groupsChanged(ctx)
+	return group, nil
+}
+
+// SetGroupPolicy stores policy on the group's persisted record, creating a
+// bare record when there is none, so every node enforces it.
+func (h *Hub) SetGroupPolicy(ctx context.Context, id string, policy GroupPolicy) (Group, error) {
+	if err := policy.Validate(); err != nil {
+		return Group{}, fmt.Errorf("%w: %w", ErrInvalidGroup, err)
+	}
+	for {
+		group, err := h.groups.Modify(ctx, id, func(stored *Group) error {
+			stored.Policy = &policy
+			stored.UpdatedAt = time.Now().UTC()
+			return nil
+		})
+		if err == nil {
+			h.groupsChanged(ctx)
+			return group, nil
+		}
+		if !errors.Is(err, ErrGroupNotFound) {
+			return Group{}, err
+		}
+		group, err = h.CreateGroup(ctx, Group{ID: id, Policy: &policy})
+		// Another caller created the record first; modify theirs instead.
+		if !errors.Is(err, ErrGroupExists) {
+			return group, err
+		}
+	}
+}
+
+// ClearGroupPolicy removes the policy from a group's persisted record. The
+// record's members, if any, still restrict joins.
+func (h *Hub) ClearGroupPolicy(ctx context.Context, id string) error {
+	_, err := h.groups.Modify(ctx, id, func(stored *Group) error {
+		if stored.Policy == nil {
+			return fmt.Errorf("%w: %s has no policy", ErrGroupNotFound, id)
+		}
+		stored.Policy = nil
+		stored.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.groupsChanged(ctx)
+	return nil
+}
+
+// GetGroup returns a persisted group.
+func (h *Hub) GetGroup(ctx context.Context, id string) (Group, error) {
+	return h.groups.Get(ctx, id)
+}
+
+// ListGroups returns every persisted group, oldest first.
+func (h *Hub) ListGroups(ctx context.Context) ([]Group, error) {
+	return h.groups.List(ctx)
+}
+
+// UpdateGroup replaces a group's metadata, members and policy, keeping its
+// creation time.
+func (h *Hub) UpdateGroup(ctx context.Context, group Group) (Group, error) {
+	if err := group.Validate(); err != nil {
+		return Group{}, err
+	}
+	if group.Name == "" {
+		group.Name = group.ID
+	}
+	updated, err := h.groups.Modify(ctx, group.ID, func(stored *Group) error {
+		group.CreatedAt = stored.CreatedAt
+		group.UpdatedAt = time.Now().UTC()
+		*stored = group
+		return nil
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	h.groupsChanged(ctx)
+	return updated, nil
+}
+
+// DeleteGroup removes a group record; connected members stay connected.
+func (h *Hub) DeleteGroup(ctx context.Context, id string) error {
+	if err := h.groups.Delete(ctx, id); err != nil {
+		return err
+	}
+	h.groupsChanged(ctx)
+	return nil
+}
+
+// AddGroupMember adds userID to a group's members.
+func (h *Hub) AddGroupMember(ctx context.Context, id, userID string) (Group, error) {
+	return h.editMembers(ctx, id, func(members []string) []string {
+		if slices.Contains(members, userID) {
+			return members
+		}
+		return append(members, userID)
+	})
+}
+
+// RemoveGroupMember removes userID from a group's members.
+func (h *Hub) RemoveGroupMember(ctx context.Context, id, userID string) (Group, error) {
+	return h.editMembers(ctx, id, func(members []string) []string {
+		return slices.DeleteFunc(members, func(m string) bool { return m == userID })
+	})
+}
+
+// editMembers changes a group's members atomically, so concurrent adds
+// and removes never lose each other's change.
+func (h *Hub) editMembers(ctx context.Context, id string, edit func([]string) []string) (Group, error) {
+	group, err := h.groups.Modify(ctx, id, func(stored *Group) error {
+		stored.Members = edit(stored.Members)
+		stored.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return Group{}, err
+	}
+	h.groupsChanged(ctx)
+	return group, nil
+}
+
+// syncGroupPolicies loads the policies implied by persisted groups into the
+// ACL. Store errors keep the previous policies.
+func (h *Hub) syncGroupPolicies(ctx context.Context) {
+	// Serialized so a slow, older listing never overwrites a newer one.
+	h.groupSyncMu.Lock()
+	defer h.groupSyncMu.Unlock()
+	groups, err := h.groups.List(ctx)
+	if err != nil {
+		log.Printf("group policy sync failed: %v", err)
+		return
+	}
+	policies := make(map[string]GroupPolicy)
+	for _, group := range groups {
+		if policy, ok := group.policy(); ok {
+			policies[group.ID] = policy
+		}
+	}
+	h.acl.setStored(policies)
+}
+
+// groupsChanged reloads local policies and tells other nodes to do the same.
+func (h *Hub) groupsChanged(ctx context.Context) {
+	h.syncGroupPolicies(ctx)
+	if h.redis == nil {
+		return
+	}
+	data, err := encodeEnvelope(broadcastMessage{id: syncGroups, source: h.instanceID, sentAt: time.Now().UTC(), sync: syncGroups})
+	if err != nil {
+		return
+	}
+	if _, err := h.publish(ctx, h.redisChannel, data); err != nil {
+		log.Printf("redis group sync publish failed: %v", err)
+	}
+}
+
+// refreshGroupPolicies picks up groups changed on other nodes until the hub
+// closes.
+func (h *Hub) refreshGroupPolicies() {
+	ticker := time.NewTicker(groupSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), groupSyncInterval)
+			h.syncGroupPolicies(ctx)
+			cancel()
+		}
+	}
+}
+
+// groupStoreFor picks Redis persistence when the backplane is up.
+func groupStoreFor(client redis.UniversalClient) GroupStore {
+	if client == nil {
+		log.Printf("groups using in-memory storage")
+		return NewMemoryGroupStore()
+	}
+	return NewRedisGroupStore(client)
+}
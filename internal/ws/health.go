@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Ping round-trips a no-op through the hub goroutine, proving that Run is
+// still consuming events. It fails when ctx expires first.
+func (h *Hub) Ping(ctx context.Context) error {
+	finished := make(chan struct{})
+	select {
+	case h.inspect <- func() { close(finished) }:
+	case <-h.done:
+		return ErrHubClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PingBackplane checks that Redis is configured, reachable and that the
+// subscriber is still running.
+func (h *Hub) PingBackplane(ctx context.Context) error {
+	if h.redis == nil {
+		return ErrRedisUnavailable
+	}
+	select {
+	case <-h.subscriberDone:
+		return errors.New("backplane subscriber stopped")
+	default:
+	}
+	return h.redis.Ping(ctx).Err()
+}
+
+// BackplaneStarted fails when the backplane could not be reached at
+// startup. The hub does not retry, so the node keeps running single-node
+// and never becomes ready; liveness uses this to get it restarted.
+func (h *Hub) BackplaneStarted(context.Context) error {
+	if h.redis == nil && h.redisErr != nil {
+		return fmt.Errorf("backplane never connected: %w", h.redisErr)
+	}
+	return nil
+}
+
+// Drain marks the hub as shutting down so readiness checks fail and load
+// balancers stop sending new connections; existing clients are untouched.
+func (h *Hub) Drain() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called.
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
@@ -0,0 +1,256 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// historyKeyPrefix namespaces one Redis stream per group.
+	historyKeyPrefix  = "ws:history:"
+	defaultHistoryMax = 1000
+	// DefaultHistoryPage and MaxHistoryPage bound one page of GroupMessages.
+	DefaultHistoryPage = 50
+	MaxHistoryPage     = 200
+	// historyQueueSize buffers writes so storage latency never stalls the hub.
+	historyQueueSize = 1024
+)
+
+var (
+	// ErrHistoryDisabled is returned when message history is not configured.
+	ErrHistoryDisabled = errors.New("message history disabled")
+	// ErrInvalidCursor is returned for a before cursor that is not a message id.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// HistoryMessage is one stored group message. IDs are "<ms>-<seq>" stream
+// ids and increase with every message in a group.
+type HistoryMessage struct {
+	ID      string    `json:"id"`
+	Group   string    `json:"group"`
+	Sender  string    `json:"sender,omitempty"`
+	SentAt  time.Time `json:"sent_at"`
+	Content string    `json:"content"`
+}
+
+// MessageStore keeps recent group messages for history pagination.
+type MessageStore interface {
+	// Append stores a message and returns its assigned id.
+	Append(ctx context.Context, msg HistoryMessage) (string, error)
+	// Page returns up to limit messages older than before, newest first;
+	// an empty before starts from the latest message.
+	Page(ctx context.Context, group, before string, limit int) ([]HistoryMessage, error)
+}
+
+// redisMessageStore appends to one capped stream per group.
+type redisMessageStore struct {
+	client redis.UniversalClient
+	max    int
+}
+
+// NewRedisMessageStore returns a store that keeps the newest max messages
+// per group in Redis streams. Exclusive range cursors need Redis 6.2 or
+// later.
+func NewRedisMessageStore(client redis.UniversalClient, max int) MessageStore {
+	return &redisMessageStore{client: client, max: max}
+}
+
+func (s *redisMessageStore) Append(ctx context.Context, msg HistoryMessage) (string, error) {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: historyKeyPrefix + msg.Group,
+		// Exact trimming so HISTORY_MAX is honoured; "~" would keep whole
+		// radix tree nodes, often far more than max.
+		MaxLen: int64(s.max),
+		Values: []string{
+			"sender", msg.Sender,
+			"sent_at", msg.SentAt.Format(time.RFC3339Nano),
+			"content", msg.Content,
+		},
+	}).Result()
+}
+
+func (s *redisMessageStore) Page(ctx context.Context, group, before string, limit int) ([]HistoryMessage, error) {
+	end := "+"
+	if before != "" {
+		if _, _, err := parseHistoryID(before); err != nil {
+			return nil, err
+		}
+		end = "(" + before
+	}
+	entries, err := s.client.XRevRangeN(ctx, historyKeyPrefix+group, end, "-", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]HistoryMessage, 0, len(entries))
+	for _, entry := range entries {
+		msg := HistoryMessage{ID: entry.ID, Group: group}
+		msg.Sender, _ = entry.Values["sender"].(string)
+		msg.Content, _ = entry.Values["content"].(string)
+		if raw, ok := entry.Values["sent_at"].(string); ok {
+			msg.SentAt, _ = time.Parse(time.RFC3339Nano, raw)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// memoryMessageStore is the single-node fallback when Redis is unavailable.
+type memoryMessageStore struct {
+	mu       sync.Mutex
+	max      int
+	lastMS   uint64
+	seq      uint64
+	messages map[string][]HistoryMessage
+}
+
+// NewMemoryMessageStore returns a process-local store that is lost on
+// restart.
+func NewMemoryMessageStore(max int) MessageStore {
+	return &memoryMessageStore{max: max, messages: make(map[string][]HistoryMessage)}
+}
+
+func (s *memoryMessageStore) Append(_ context.Context, msg HistoryMessage) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Mirror stream ids so cursors look the same with either store.
+	if ms := uint64(time.Now().UnixMilli()); ms > s.lastMS {
+		s.lastMS, s.seq = ms, 0
+	} else {
+		s.seq++
+	}
+	msg.ID = strconv.FormatUint(s.lastMS, 10) + "-" + strconv.FormatUint(s.seq, 10)
+	messages := append(s.messages[msg.Group], msg)
+	if len(messages) > s.max {
+		messages = messages[len(messages)-s.max:]
+	}
+	s.messages[msg.Group] = messages
+	return msg.ID, nil
+}
+
+func (s *memoryMessageStore) Page(_ context.Context, group, before string, limit int) ([]HistoryMessage, error) {
+	var cutMS, cutSeq uint64
+	if before != "" {
+		var err error
+		if cutMS, cutSeq, err = parseHistoryID(before); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.messages[group]
+	out := make([]HistoryMessage, 0, min(limit, len(stored)))
+	for i := len(stored) - 1; i >= 0 && len(out) < limit; i-- {
+		if before != "" {
+			ms, seq, _ := parseHistoryID(stored[i].ID)
+			if ms > cutMS || (ms == cutMS && seq >= cutSeq) {
+				continue
+			}
+		}
+		out = append(out, stored[i])
+	}
+	return out, nil
+}
+
+// parseHistoryID splits a "<ms>-<seq>" message id.
+func parseHistoryID(id string) (uint64, uint64, error) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	ms, err1 := strconv.ParseUint(msPart, 10, 64)
+	seq, err2 := strconv.ParseUint(seqPart, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, id)
+	}
+	return ms, seq, nil
+}
+
+// WithHistory stores group messages, keeping the newest max per group.
+func WithHistory(max int) Option {
+	return func(h *Hub) {
+		h.historyMax = max
+	}
+}
+
+// historyMaxFromEnv reads HISTORY_ENABLED and HISTORY_MAX, returning 0
+// when history is off.
+func historyMaxFromEnv() int {
+	if enabled, _ := strconv.ParseBool(os.Getenv("HISTORY_ENABLED")); !enabled {
+		return 0
+	}
+	max := defaultHistoryMax
+	if raw := os.Getenv("HISTORY_MAX"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			max = parsed
+		} else {
+			log.Printf("invalid HISTORY_MAX %q, using %d", raw, defaultHistoryMax)
+		}
+	}
+	return max
+}
+
+// startHistory picks the store for the configured cap and starts the writer.
+func (h *Hub) startHistory() {
+	if h.historyMax <= 0 {
+		return
+	}
+	if h.redis == nil {
+		log.Printf("message history using in-memory storage")
+		h.history = NewMemoryMessageStore(h.historyMax)
+	} else {
+		h.history = NewRedisMessageStore(h.redis, h.historyMax)
+	}
+	h.historyQueue = make(chan HistoryMessage, historyQueueSize)
+	go h.runHistoryWriter()
+}
+
+// recordHistory queues a locally originated group message for storage. Only
+// the origin node records it, so each message is stored once per cluster.
+func (h *Hub) recordHistory(msg broadcastMessage) {
+	groups := msg.groups
+	if msg.group != "" {
+		groups = append([]string{msg.group}, groups...)
+	}
+	for _, group := range groups {
+		item := HistoryMessage{Group: group, Sender: msg.userID, SentAt: msg.sentAt, Content: string(msg.payload)}
+		select {
+		case h.historyQueue <- item:
+		default:
+			log.Printf("message history queue full, dropped %s for group=%s", msg.id, group)
+		}
+	}
+}
+
+// runHistoryWriter appends queued messages in order until the hub closes.
+func (h *Hub) runHistoryWriter() {
+	for {
+		select {
+		case <-h.done:
+			return
+		case item := <-h.historyQueue:
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if _, err := h.history.Append(ctx, item); err != nil {
+				log.Printf("message history append group=%s failed: %v", item.Group, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// GroupMessages returns a page of a group's history, newest first. A limit
+// outside 1..MaxHistoryPage is clamped.
+func (h *Hub) GroupMessages(ctx context.Context, group, before string, limit int) ([]HistoryMessage, error) {
+	if h.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryPage
+	}
+	return h.history.Page(ctx, group, before, min(limit, MaxHistoryPage))
+}
@@ -0,0 +1,153 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+var errInterceptorPanicked = errors.New("interceptor panicked")
+
+// DisconnectReason says why a connection ended.
+type DisconnectReason string
+
+const (
+	// DisconnectClosed means the client closed or the read failed.
+	DisconnectClosed DisconnectReason = "closed"
+	// DisconnectDropped means the hub dropped a client whose send buffer was full.
+	DisconnectDropped DisconnectReason = "dropped"
+	// DisconnectEvicted means a connection limit closed it to admit a newer one.
+	DisconnectEvicted DisconnectReason = "evicted"
+	// DisconnectShutdown means the hub was closed.
+	DisconnectShutdown DisconnectReason = "shutdown"
+)
+
+// Message is the interceptor view of a locally originated message. The
+// targeting fields can be rewritten to reroute it and Payload or Metadata
+// replaced to mutate it.
+type Message struct {
+	ID string
+	// Sender is the connection that sent the frame, nil for API sends.
+	Sender *Client
+	// UserID, Group, Groups, Topic and All select local and cross-node targets.
+	UserID string
+	Group  string
+	Groups []string
+	Topic  string
+	All    bool
+	// Users are the per-user Redis targets of PublishToUsers.
+	Users    []string
+	Payload  []byte
+	Metadata map[string]string
+}
+
+// Interceptor inspects a message before fan-out. Returning an error drops
+// the message; the error is wrapped with ErrMessageRejected.
+type Interceptor func(msg *Message) error
+
+// hooks are the application callbacks registered through options. They run
+// on connection or caller goroutines, never on the hub goroutine.
+type hooks struct {
+	onConnect    []func(*Client)
+	onMessage    []func(*Client, []byte)
+	onDisconnect []func(*Client, DisconnectReason)
+	interceptors []Interceptor
+}
+
+// OnConnect registers fn to run after a connection is registered.
+func OnConnect(fn func(c *Client)) Option {
+	return func(h *Hub) {
+		h.hooks.onConnect = append(h.hooks.onConnect, fn)
+	}
+}
+
+// OnMessage registers fn to run for every inbound frame, before interceptors.
+func OnMessage(fn func(c *Client, payload []byte)) Option {
+	return func(h *Hub) {
+		h.hooks.onMessage = append(h.hooks.onMessage, fn)
+	}
+}
+
+// OnDisconnect registers fn to run once a connection has ended.
+func OnDisconnect(fn func(c *Client, reason DisconnectReason)) Option {
+	return func(h *Hub) {
+		h.hooks.onDisconnect = append(h.hooks.onDisconnect, fn)
+	}
+}
+
+// WithInterceptor appends an interceptor; interceptors run in registration
+// order and the first error stops the chain.
+func WithInterceptor(fn Interceptor) Option {
+	return func(h *Hub) {
+		h.hooks.interceptors = append(h.hooks.interceptors, fn)
+	}
+}
+
+func (h *Hub) runConnectHooks(c *Client) {
+	for _, fn := range h.hooks.onConnect {
+		safely("OnConnect", func() { fn(c) })
+	}
+}
+
+func (h *Hub) runMessageHooks(c *Client, payload []byte) {
+	for _, fn := range h.hooks.onMessage {
+		safely("OnMessage", func() { fn(c, payload) })
+	}
+}
+
+func (h *Hub) runDisconnectHooks(c *Client, reason DisconnectReason) {
+	for _, fn := range h.hooks.onDisconnect {
+		safely("OnDisconnect", func() { fn(c, reason) })
+	}
+}
+
+// intercept runs the interceptor chain on msg and applies any rewrites.
+func (h *Hub) intercept(msg *broadcastMessage, sender *Client, users *[]string) error {
+	if len(h.hooks.interceptors) == 0 {
+		return nil
+	}
+	view := Message{
+		ID:       msg.id,
+		Sender:   sender,
+		UserID:   msg.userID,
+		Group:    msg.group,
+		Groups:   msg.groups,
+		Topic:    msg.topic,
+		All:      msg.all,
+		Payload:  msg.payload,
+		Metadata: msg.metadata,
+	}
+	if users != nil {
+		view.Users = *users
+	}
+	for _, fn := range h.hooks.interceptors {
+		// A panicking interceptor rejects rather than letting the message through.
+		err := errInterceptorPanicked
+		safely("interceptor", func() { err = fn(&view) })
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMessageRejected, err)
+		}
+	}
+	msg.userID = view.UserID
+	msg.group = view.Group
+	msg.groups = view.Groups
+	msg.topic = view.Topic
+	msg.all = view.All
+	msg.payload = view.Payload
+	msg.metadata = view.Metadata
+	if users != nil {
+		*users = view.Users
+	}
+	return nil
+}
+
+// safely keeps a panicking hook from taking the connection or hub down.
+func safely(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ws %s hook panicked: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+	fn()
+}
@@ -2,17 +2,20 @@ package ws
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
+
+	"go-playground/internal/schema"
 )
 
 // Hub coordinates registered clients and message broadcasts.
@@ -22,52 +25,178 @@ type Hub struct {
 	broadcast      chan broadcastMessage
 	clientsByGroup map[string]map[*Client]struct{}
 	clientsByUser  map[string]map[*Client]struct{}
+	clientsByTopic map[string]map[*Client]struct{}
+	clientsByIP    map[string]map[*Client]struct{}
+	connections    int
+	connSeq        atomic.Uint64
+	limits         Limits
 	instanceID     string
-	redis          *redis.Client
+	redis          redis.UniversalClient
+	redisConfig    *RedisConfig
 	redisChannel   string
-	userSubs       map[string]*userSubscription
+	sharded        bool
+	pubsubs        map[string]*redis.PubSub
+	userSubs       map[string]int
+	subQueue       *subscriptionQueue
+	receiptTTL     time.Duration
+	inbox          Inbox
+	history        MessageStore
+	historyMax     int
+	historyQueue   chan HistoryMessage
+	inspect        chan func()
+	done           chan struct{}
+	closeOnce      sync.Once
+	draining       atomic.Bool
+	hooks          hooks
+	acl            *ACL
+	groups         GroupStore
+	groupSyncMu    sync.Mutex
+	schemas        map[string]*schema.Schema
+	rpcHandlers    map[string]RPCHandler
+	rpcTimeout     time.Duration
+	calls          callTable
+	replyChannel   string
+	state          stateTable
+	subscriberDone chan struct{}
+	// redisErr is why the backplane failed to connect at startup, if it did.
+	redisErr error
 }
 
-// NewHub constructs a hub with initialized channels.
-func NewHub() *Hub {
+// NewHub constructs a hub with initialized channels. Without options the
+// Redis backplane is configured from the REDIS_* environment variables.
+func NewHub(opts ...Option) *Hub {
 	hub := &Hub{
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
 		broadcast:      make(chan broadcastMessage, 128),
 		clientsByGroup: make(map[string]map[*Client]struct{}),
 		clientsByUser:  make(map[string]map[*Client]struct{}),
+		clientsByTopic: make(map[string]map[*Client]struct{}),
+		clientsByIP:    make(map[string]map[*Client]struct{}),
 		instanceID:     newInstanceID(),
-		userSubs:       make(map[string]*userSubscription),
+		userSubs:       make(map[string]int),
+		subQueue:       newSubscriptionQueue(),
+		pubsubs:        make(map[string]*redis.PubSub),
+		receiptTTL:     defaultReceiptTTL,
+		inspect:        make(chan func()),
+		done:           make(chan struct{}),
+		subscriberDone: make(chan struct{}),
+		state: stateTable{
+			flush:   defaultStateFlush,
+			ttl:     defaultStateTTL,
+			groups:  make(map[string]map[stateSlot]*stateEntry),
+			cleared: make(map[string][]stateUpdate),
+		},
+	}
+	if raw := os.Getenv("NOTIFY_RECEIPT_TTL"); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			hub.receiptTTL = ttl
+		} else {
+			log.Printf("invalid NOTIFY_RECEIPT_TTL %q, using %s", raw, defaultReceiptTTL)
+		}
 	}
+	hub.historyMax = historyMaxFromEnv()
 
-	// Redis is optional; default to localhost for local multi-node testing.
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
+	for _, opt := range opts {
+		opt(hub)
 	}
+	if hub.acl == nil {
+		// An empty ACL allows everything and can still be edited at runtime.
+		hub.acl, _ = NewACL(nil)
+	}
+	go hub.runStateFlusher()
+
+	// Redis is optional; the hub runs single-node when it is unreachable.
+	hub.connectRedis()
+	hub.inbox = newInboxFromEnv(hub.redis)
+	hub.startHistory()
+	hub.groups = groupStoreFor(hub.redis)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	hub.syncGroupPolicies(ctx)
+	cancel()
 
-	hub.redis = redis.NewClient(&redis.Options{Addr: redisAddr})
-	hub.redisChannel = "ws:broadcast"
-	if channel := os.Getenv("REDIS_CHANNEL"); channel != "" {
-		hub.redisChannel = channel
+	if hub.redis != nil {
+		hub.startRedisSubscriber()
+		go hub.refreshSlots()
+		go hub.refreshGroupPolicies()
+	}
+	return hub
+}
+
+// connectRedis builds and pings the backplane client, leaving h.redis nil
+// and recording the cause in h.redisErr on failure.
+func (h *Hub) connectRedis() {
+	var cfg RedisConfig
+	if h.redisConfig != nil {
+		cfg = *h.redisConfig
+	} else {
+		var err error
+		if cfg, err = RedisConfigFromEnv(); err != nil {
+			log.Printf("redis config invalid: %v", err)
+			h.redisErr = err
+			return
+		}
+	}
+	client, err := cfg.NewClient()
+	if err != nil {
+		log.Printf("redis config invalid: %v", err)
+		h.redisErr = err
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	if err := hub.redis.Ping(ctx).Err(); err != nil {
-		log.Printf("redis unavailable at %s: %v", redisAddr, err)
-		hub.redis = nil
-		return hub
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("redis unavailable at %s: %v", cfg, err)
+		_ = client.Close()
+		h.redisErr = err
+		return
+	}
+	h.redis = client
+	h.redisChannel = cfg.Channel
+	if h.redisChannel == "" {
+		h.redisChannel = "ws:broadcast"
 	}
+	h.sharded = cfg.Sharded
+}
 
-	hub.startRedisSubscriber()
-	return hub
+// newInboxFromEnv builds the offline inbox when INBOX_ENABLED is set,
+// falling back to memory when Redis is not reachable.
+func newInboxFromEnv(client redis.UniversalClient) Inbox {
+	if enabled, _ := strconv.ParseBool(os.Getenv("INBOX_ENABLED")); !enabled {
+		return nil
+	}
+	ttl := defaultInboxTTL
+	if raw := os.Getenv("INBOX_TTL"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			ttl = parsed
+		} else {
+			log.Printf("invalid INBOX_TTL %q, using %s", raw, defaultInboxTTL)
+		}
+	}
+	max := defaultInboxMax
+	if raw := os.Getenv("INBOX_MAX"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			max = parsed
+		} else {
+			log.Printf("invalid INBOX_MAX %q, using %d", raw, defaultInboxMax)
+		}
+	}
+	if client == nil {
+		log.Printf("inbox using in-memory storage")
+		return NewMemoryInbox(ttl, max)
+	}
+	return NewRedisInbox(client, ttl, max)
 }
 
 // Run processes all hub events in a single goroutine.
 func (h *Hub) Run() {
 	for {
 		select {
+		case <-h.done:
+			return
+		case fn := <-h.inspect:
+			fn()
 		case client := <-h.register:
 			// Track by group and by user id for scoped broadcasts.
 			if h.clientsByGroup[client.group] == nil {
@@ -78,31 +207,126 @@ func (h *Hub) Run() {
 				h.clientsByUser[client.id] = make(map[*Client]struct{})
 			}
 			h.clientsByUser[client.id][client] = struct{}{}
+			if h.clientsByIP[client.ip] == nil {
+				h.clientsByIP[client.ip] = make(map[*Client]struct{})
+			}
+			h.clientsByIP[client.ip][client] = struct{}{}
+			h.connections++
+			for _, topic := range client.topics {
+				if h.clientsByTopic[topic] == nil {
+					h.clientsByTopic[topic] = make(map[*Client]struct{})
+				}
+				h.clientsByTopic[topic][client] = struct{}{}
+			}
 			h.ensureUserSubscription(client.id)
+			if h.inbox != nil && len(h.clientsByUser[client.id]) == 1 {
+				// Only the user's first local connection replays the inbox.
+				go h.drainInbox(client)
+			}
 		case client := <-h.unregister:
-			group := h.clientsByGroup[client.group]
-			if _, ok := group[client]; ok {
-				delete(group, client)
+			if h.detach(client) {
 				close(client.send)
-				if len(group) == 0 {
-					delete(h.clientsByGroup, client.group)
-				}
-			}
-			user := h.clientsByUser[client.id]
-			if _, ok := user[client]; ok {
-				delete(user, client)
-				if len(user) == 0 {
-					delete(h.clientsByUser, client.id)
-				}
 			}
 			h.releaseUserSubscription(client.id)
 		case msg := <-h.broadcast:
 			// Redis fan-out only happens for local messages.
-			if h.redis != nil && msg.source == h.instanceID {
+			if h.redis != nil && !msg.remote && msg.client == nil {
 				h.publishRedis(msg)
 			}
-			h.fanout(msg)
+			if h.history != nil && !msg.remote && msg.client == nil && !msg.ephemeral {
+				h.recordHistory(msg)
+			}
+			delivered := h.fanout(msg)
+			if msg.receipt {
+				// Report back off the hub goroutine so Redis latency never stalls fan-out.
+				go h.recordDelivery(msg.id, msg.userID, delivered)
+			}
+			if h.inbox != nil && delivered == 0 {
+				switch {
+				case msg.client != nil:
+					// The client left before its inbox replay arrived; keep the item.
+					go h.storeOffline(context.Background(), msg.client.id, msg.id, msg.payload)
+				case msg.queueOffline:
+					go h.queueOffline(msg.userID, msg.id, msg.payload)
+				}
+			}
+		}
+	}
+}
+
+// Stats is a point-in-time view of local connections.
+type Stats struct {
+	Connections int `json:"connections"`
+	Users       int `json:"users"`
+	Groups      int `json:"groups"`
+	Topics      int `json:"topics"`
+}
+
+// Stats reports local connection counts, read inside the hub goroutine.
+func (h *Hub) Stats() Stats {
+	var stats Stats
+	h.do(func() {
+		for _, clients := range h.clientsByUser {
+			stats.Connections += len(clients)
 		}
+		stats.Users = len(h.clientsByUser)
+		stats.Groups = len(h.clientsByGroup)
+		stats.Topics = len(h.clientsByTopic)
+	})
+	return stats
+}
+
+// UserConnections reports how many local connections a user holds.
+func (h *Hub) UserConnections(userID string) int {
+	count := 0
+	h.do(func() {
+		count = len(h.clientsByUser[userID])
+	})
+	return count
+}
+
+// Close stops the hub loop and releases the Redis backplane. It is safe to
+// call more than once.
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+		if h.redis != nil {
+			<-h.subscriberDone
+			_ = h.redis.Close()
+		}
+	})
+}
+
+// do runs fn on the hub goroutine and waits; it reports false once closed.
+func (h *Hub) do(fn func()) bool {
+	finished := make(chan struct{})
+	select {
+	case h.inspect <- func() {
+		fn()
+		close(finished)
+	}:
+	case <-h.done:
+		return false
+	}
+	<-finished
+	return true
+}
+
+// submit runs interceptors on a locally originated message and enqueues it
+// unless one rejects it.
+func (h *Hub) submit(msg broadcastMessage) {
+	if err := h.intercept(&msg, nil, nil); err != nil {
+		log.Printf("ws message %s dropped: %v", msg.id, err)
+		return
+	}
+	h.enqueue(msg)
+}
+
+// enqueue hands a message to the hub loop unless the hub is closed.
+func (h *Hub) enqueue(msg broadcastMessage) {
+	select {
+	case h.broadcast <- msg:
+	case <-h.done:
 	}
 }
 
@@ -111,21 +335,71 @@ func (h *Hub) SendToUser(userID string, payload []byte) {
 	if userID == "" {
 		return
 	}
-	h.broadcast <- broadcastMessage{
-		userID:  userID,
-		payload: payload,
-		source:  h.instanceID,
+	msg := h.newMessage(payload)
+	msg.userID = userID
+	msg.queueOffline = true
+	h.submit(msg)
+}
+
+// BroadcastAll sends a payload to every connected client across all nodes.
+func (h *Hub) BroadcastAll(payload []byte) {
+	msg := h.newMessage(payload)
+	msg.all = true
+	h.submit(msg)
+}
+
+// SendToGroups sends a payload to every member of the listed groups.
+func (h *Hub) SendToGroups(groups []string, payload []byte) {
+	if len(groups) == 0 {
+		return
+	}
+	msg := h.newMessage(payload)
+	msg.groups = groups
+	h.submit(msg)
+}
+
+// SendToTopic sends a payload to clients whose subscriptions match the pattern.
+func (h *Hub) SendToTopic(pattern string, payload []byte) {
+	if pattern == "" {
+		return
 	}
+	msg := h.newMessage(payload)
+	msg.topic = pattern
+	h.submit(msg)
 }
 
 // Client is a single websocket connection.
 type Client struct {
-	conn  *websocket.Conn
-	send  chan []byte
-	id    string
-	group string
+	conn   *websocket.Conn
+	send   chan []byte
+	id     string
+	group  string
+	topics []string
+	debug  bool
+	// key identifies the connection across the cluster.
+	key         string
+	ip          string
+	connectedAt time.Time
+	// dropped is set when the hub gives up on a stalled client.
+	dropped atomic.Bool
+	// evicted is set when a connection limit closed the client.
+	evicted atomic.Bool
+	// rpcSlots bounds the client's concurrent RPC calls.
+	rpcSlots chan struct{}
 }
 
+// UserID returns the id the client connected as.
+func (c *Client) UserID() string { return c.id }
+
+// Group returns the client's group.
+func (c *Client) Group() string { return c.group }
+
+// Topics returns the client's topic subscriptions.
+func (c *Client) Topics() []string { return c.topics }
+
+// RemoteAddr returns the peer address of the connection.
+func (c *Client) RemoteAddr() string { return c.conn.RemoteAddr().String() }
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -136,11 +410,6 @@ var upgrader = websocket.Upgrader{
 
 // HandleWebSocket upgrades the HTTP request and registers the client.
 func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *Hub) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return
-	}
-
 	// Read the requested id + group to isolate sessions.
 	id := r.URL.Query().Get("id")
 	if id == "" {
@@ -151,9 +420,59 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *Hub) {
 		group = "default"
 	}
 
-	client := &Client{conn: conn, send: make(chan []byte, 64), id: id, group: group}
-	hub.register <- client
+	// Topics are optional subscriptions matched by pattern broadcasts.
+	topics := splitTopics(r.URL.Query().Get("topics"))
+
+	// Debug clients get relayed frames tagged so the test UI can show the route.
+	debug, _ := strconv.ParseBool(r.URL.Query().Get("debug"))
+
+	// Group policies are checked before the upgrade so rejections are plain HTTP.
+	if err := hub.authorizeJoin(r.Context(), id, group); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, ErrGroupFull) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	ip := clientIP(r, hub.limits.TrustProxy)
+	room, err := hub.admit(r.Context(), id, ip)
+	if err != nil {
+		status := http.StatusTooManyRequests
+		if errors.Is(err, ErrNodeFull) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	client := &Client{
+		conn:        conn,
+		send:        make(chan []byte, 64),
+		id:          id,
+		group:       group,
+		topics:      topics,
+		debug:       debug,
+		rpcSlots:    make(chan struct{}, maxRPCInFlight),
+		key:         hub.instanceID + "-" + strconv.FormatUint(hub.connSeq.Add(1), 10),
+		ip:          ip,
+		connectedAt: time.Now(),
+	}
+	hub.claimSlots(r.Context(), client)
+	select {
+	case hub.register <- client:
+	case <-hub.done:
+		_ = conn.Close()
+		return
+	}
+	hub.makeRoom(r.Context(), room)
 
+	hub.runConnectHooks(client)
 	go client.writePump()
 	client.readPump(hub)
 }
@@ -161,8 +480,22 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *Hub) {
 // readPump reads messages from the websocket and forwards them to the hub.
 func (c *Client) readPump(hub *Hub) {
 	defer func() {
-		hub.unregister <- c
+		reason := DisconnectClosed
+		select {
+		case hub.unregister <- c:
+			switch {
+			case c.dropped.Load():
+				reason = DisconnectDropped
+			case c.evicted.Load():
+				reason = DisconnectEvicted
+			}
+		case <-hub.done:
+			reason = DisconnectShutdown
+		}
 		_ = c.conn.Close()
+		hub.releaseSlot(c)
+		hub.clearStates(c)
+		hub.runDisconnectHooks(c, reason)
 	}()
 
 	c.conn.SetReadLimit(1 << 20)
@@ -180,8 +513,36 @@ func (c *Client) readPump(hub *Hub) {
 			}
 			return
 		}
+		if req, ok := parseRPC(msg); ok {
+			hub.handleRPC(c, req)
+			continue
+		}
+		if reply, ok := parseCallReply(msg); ok {
+			hub.handleCallReply(c, reply)
+			continue
+		}
+		if err := hub.authorizePublish(c); err != nil {
+			hub.sendError(c, frameError{Code: "publish_denied", Message: err.Error()}, "")
+			continue
+		}
+		if problem, ref := hub.validateFrame(msg); problem != nil {
+			hub.sendError(c, *problem, ref)
+			continue
+		}
+		if update, ok := parseState(msg); ok {
+			// State is coalesced and flushed on its own schedule, never stored.
+			hub.setState(c, update)
+			continue
+		}
+		hub.runMessageHooks(c, msg)
 		// Preserve echo semantics, then publish to redis for other nodes.
-		hub.broadcast <- broadcastMessage{group: c.group, userID: c.id, payload: msg, source: hub.instanceID}
+		out := hub.newMessage(msg)
+		out.group = c.group
+		out.userID = c.id
+		if err := hub.intercept(&out, c, nil); err != nil {
+			continue
+		}
+		hub.enqueue(out)
 	}
 }
 
@@ -198,7 +559,11 @@ func (c *Client) writePump() {
 		case msg, ok := <-c.send:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeFrame := []byte{}
+				if c.evicted.Load() {
+					closeFrame = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "evicted: connection limit")
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
 				return
 			}
 			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
@@ -213,41 +578,88 @@ func (c *Client) writePump() {
 	}
 }
 
-// broadcastMessage keeps payloads scoped for group and user broadcasts.
+// broadcastMessage keeps payloads scoped for group, user, topic and global broadcasts.
 type broadcastMessage struct {
-	group   string
-	userID  string
-	payload []byte
-	source  string
-}
-
-// redisEnvelope is the cross-node wire format carried by Redis pub/sub.
-type redisEnvelope struct {
-	Group   string `json:"group"`
-	UserID  string `json:"user_id"`
-	Payload string `json:"payload"`
-	Source  string `json:"source"`
-}
-
-type userSubscription struct {
-	sub    *redis.PubSub
-	cancel context.CancelFunc
-	count  int
+	id       string
+	group    string
+	groups   []string
+	userID   string
+	topic    string
+	all      bool
+	payload  []byte
+	source   string
+	sentAt   time.Time
+	metadata map[string]string
+	// remote marks messages that arrived through Redis and must not be republished.
+	remote bool
+	// receipt asks the receiving node to report delivery for the notification id.
+	receipt bool
+	// queueOffline stores the payload in the user's inbox when nobody received it.
+	queueOffline bool
+	// client targets a single connection, used for inbox replay.
+	client *Client
+	// call carries a server-to-client call instead of a payload.
+	call *callRequest
+	// evict names a connection to close for a cluster-wide limit.
+	evict string
+	// sync asks other nodes to reload shared state, such as "groups".
+	sync string
+	// ephemeral marks coalesced state frames, which skip busy clients
+	// instead of dropping them and are never stored.
+	ephemeral bool
 }
 
-func (h *Hub) fanout(msg broadcastMessage) {
-	sent := make(map[*Client]struct{})
+// fanout delivers the message locally and returns how many clients accepted it.
+func (h *Hub) fanout(msg broadcastMessage) int {
+	// Collect targets first so a client matching several scopes gets one copy.
+	targets := make(map[*Client]struct{})
+	if msg.all {
+		for _, clients := range h.clientsByUser {
+			for client := range clients {
+				targets[client] = struct{}{}
+			}
+		}
+	}
 	for client := range h.clientsByGroup[msg.group] {
-		if h.trySend(client, msg.payload) {
-			sent[client] = struct{}{}
+		targets[client] = struct{}{}
+	}
+	for _, group := range msg.groups {
+		for client := range h.clientsByGroup[group] {
+			targets[client] = struct{}{}
 		}
 	}
 	for client := range h.clientsByUser[msg.userID] {
-		if _, ok := sent[client]; ok {
+		targets[client] = struct{}{}
+	}
+	if msg.topic != "" {
+		for topic, clients := range h.clientsByTopic {
+			if !matchTopic(msg.topic, topic) {
+				continue
+			}
+			for client := range clients {
+				targets[client] = struct{}{}
+			}
+		}
+	}
+	if msg.client != nil {
+		// Skip direct deliveries to clients that already went away.
+		if _, ok := h.clientsByUser[msg.client.id][msg.client]; ok {
+			targets[msg.client] = struct{}{}
+		}
+	}
+	delivered := 0
+	for client := range targets {
+		if msg.ephemeral {
+			if trySendEphemeral(client, frameFor(client, msg)) {
+				delivered++
+			}
 			continue
 		}
-		h.trySend(client, msg.payload)
+		if h.trySend(client, frameFor(client, msg)) {
+			delivered++
+		}
 	}
+	return delivered
 }
 
 // trySend attempts to enqueue a payload and cleans up stalled clients.
@@ -256,130 +668,96 @@ func (h *Hub) trySend(client *Client, payload []byte) bool {
 	case client.send <- payload:
 		return true
 	default:
-		close(client.send)
-		if group := h.clientsByGroup[client.group]; group != nil {
-			delete(group, client)
-			if len(group) == 0 {
-				delete(h.clientsByGroup, client.group)
-			}
-		}
-		if user := h.clientsByUser[client.id]; user != nil {
-			delete(user, client)
-			if len(user) == 0 {
-				delete(h.clientsByUser, client.id)
-			}
+		if h.detach(client) {
+			client.dropped.Store(true)
+			close(client.send)
 		}
 		return false
 	}
 }
 
-// startRedisSubscriber fans Redis broadcasts back into the local hub.
-func (h *Hub) startRedisSubscriber() {
-	ctx := context.Background()
-	sub := h.redis.Subscribe(ctx, h.redisChannel)
-	ch := sub.Channel()
-
-	go func() {
-		for msg := range ch {
-			var env redisEnvelope
-			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
-				continue
-			}
-			if env.Source == h.instanceID {
-				continue
-			}
-			payload, err := base64.StdEncoding.DecodeString(env.Payload)
-			if err != nil {
-				continue
-			}
-			h.broadcast <- broadcastMessage{
-				group:   env.Group,
-				userID:  env.UserID,
-				payload: payload,
-				source:  env.Source,
-			}
+// detach removes a client from every index and reports whether it was tracked.
+func (h *Hub) detach(client *Client) bool {
+	group := h.clientsByGroup[client.group]
+	if _, ok := group[client]; !ok {
+		return false
+	}
+	delete(group, client)
+	if len(group) == 0 {
+		delete(h.clientsByGroup, client.group)
+	}
+	if user := h.clientsByUser[client.id]; user != nil {
+		delete(user, client)
+		if len(user) == 0 {
+			delete(h.clientsByUser, client.id)
 		}
-	}()
-}
-
-// ensureUserSubscription registers a per-user Redis subscription once.
-func (h *Hub) ensureUserSubscription(userID string) {
-	if h.redis == nil || userID == "" {
-		return
 	}
-	sub, ok := h.userSubs[userID]
-	if ok {
-		sub.count++
-		return
+	if byIP := h.clientsByIP[client.ip]; byIP != nil {
+		delete(byIP, client)
+		if len(byIP) == 0 {
+			delete(h.clientsByIP, client.ip)
+		}
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	pubsub := h.redis.Subscribe(ctx, userChannel(userID))
-	entry := &userSubscription{cancel: cancel, sub: pubsub, count: 1}
-	h.userSubs[userID] = entry
-
-	ch := pubsub.Channel()
-	go func() {
-		for msg := range ch {
-			// Prefix so the frontend log can identify redis messages.
-			payload := []byte("[redis] " + msg.Payload)
-			log.Printf("redis user message user=%s payload=%s", userID, msg.Payload)
-			h.broadcast <- broadcastMessage{
-				userID:  userID,
-				payload: payload,
-				source:  "redis-user",
+	h.connections--
+	for _, topic := range client.topics {
+		if clients := h.clientsByTopic[topic]; clients != nil {
+			delete(clients, client)
+			if len(clients) == 0 {
+				delete(h.clientsByTopic, topic)
 			}
 		}
-	}()
+	}
+	return true
 }
 
-// releaseUserSubscription decrements and closes the user subscription when unused.
-func (h *Hub) releaseUserSubscription(userID string) {
-	if h.redis == nil || userID == "" {
-		return
+// PublishToUsers sends a payload to specific user channels via Redis and
+// returns the notification id used to track delivery receipts.
+func (h *Hub) PublishToUsers(userIDs []string, payload []byte) (string, error) {
+	if h.redis == nil {
+		return "", ErrRedisUnavailable
 	}
-	sub, ok := h.userSubs[userID]
-	if !ok {
-		return
+	msg := h.newMessage(payload)
+	msg.receipt = true
+	if err := h.intercept(&msg, nil, &userIDs); err != nil {
+		return "", err
 	}
-	sub.count--
-	if sub.count > 0 {
-		return
+	payload = msg.payload
+	id := msg.id
+	ctx := context.Background()
+	if err := h.startReceipt(ctx, id, userIDs); err != nil {
+		log.Printf("redis receipt init id=%s failed: %v", id, err)
 	}
-	sub.cancel()
-	_ = sub.sub.Close()
-	delete(h.userSubs, userID)
-}
-
-// PublishToUsers sends a payload to specific user channels via Redis.
-func (h *Hub) PublishToUsers(userIDs []string, payload []byte) {
-	if h.redis == nil {
-		return
+	data, err := encodeEnvelope(msg)
+	if err != nil {
+		return "", err
 	}
 	for _, userID := range userIDs {
 		if userID == "" {
 			continue
 		}
-		if err := h.redis.Publish(context.Background(), userChannel(userID), payload).Err(); err != nil {
+		// The receiver count tells us whether any node had the user subscribed.
+		receivers, err := h.publish(ctx, h.userChannel(userID), data)
+		if err != nil {
 			log.Printf("redis publish user=%s failed: %v", userID, err)
+			continue
+		}
+		if err := h.recordReceivers(ctx, id, userID, receivers); err != nil {
+			log.Printf("redis receipt user=%s id=%s failed: %v", userID, id, err)
+		}
+		if receivers == 0 && h.inbox != nil {
+			h.storeOffline(ctx, userID, id, payload)
 		}
 	}
+	return id, nil
 }
 
 // publishRedis publishes the message to other nodes via Redis.
 func (h *Hub) publishRedis(msg broadcastMessage) {
-	payload := base64.StdEncoding.EncodeToString(msg.payload)
-	env := redisEnvelope{
-		Group:   msg.group,
-		UserID:  msg.userID,
-		Payload: payload,
-		Source:  msg.source,
-	}
-	data, err := json.Marshal(env)
+	data, err := encodeEnvelope(msg)
 	if err != nil {
 		return
 	}
-	if err := h.redis.Publish(context.Background(), h.redisChannel, data).Err(); err != nil {
+	if _, err := h.publish(context.Background(), h.redisChannel, data); err != nil {
 		log.Printf("redis publish failed: %v", err)
 	}
 }
@@ -388,9 +766,16 @@ func newInstanceID() string {
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid())
 }
 
-func userChannel(userID string) string {
-	return "ws:user:" + userID
-}
-
-// ErrNotUsed is kept to show how to add errors later without import churn.
-var ErrNotUsed = errors.New("reserved")
+var (
+	// ErrRedisUnavailable is returned when a feature needs the Redis backplane.
+	ErrRedisUnavailable = errors.New("redis backplane unavailable")
+	// ErrNotificationNotFound is returned for unknown or expired notification ids.
+	ErrNotificationNotFound = errors.New("notification not found")
+	// ErrInboxDisabled is returned when offline inboxes are not configured.
+	ErrInboxDisabled = errors.New("offline inbox disabled")
+	// ErrHubClosed is returned by health checks once the hub has stopped.
+	ErrHubClosed = errors.New("hub closed")
+	// ErrMessageRejected wraps interceptor errors so callers can tell a policy
+	// rejection from a transport failure.
+	ErrMessageRejected = errors.New("message rejected")
+)
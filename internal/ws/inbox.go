@@ -0,0 +1,239 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultInboxTTL = 24 * time.Hour
+	defaultInboxMax = 100
+)
+
+// InboxItem is a notification waiting for an offline user.
+type InboxItem struct {
+	ID        string    `json:"id"`
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Inbox stores undelivered notifications per user until they reconnect.
+type Inbox interface {
+	// Push appends an item, trimming expired and overflowing entries.
+	Push(ctx context.Context, userID string, item InboxItem) error
+	// List returns pending items oldest first without removing them.
+	List(ctx context.Context, userID string) ([]InboxItem, error)
+	// Drain atomically returns and removes all pending items.
+	Drain(ctx context.Context, userID string) ([]InboxItem, error)
+	// Purge removes all pending items and reports how many were dropped.
+	Purge(ctx context.Context, userID string) (int, error)
+}
+
+// redisInbox keeps one sorted set per user scored by creation time.
+type redisInbox struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+	max    int
+}
+
+// NewRedisInbox returns an inbox persisted in Redis sorted sets.
+func NewRedisInbox(client redis.UniversalClient, ttl time.Duration, max int) Inbox {
+	return &redisInbox{client: client, ttl: ttl, max: max}
+}
+
+func (i *redisInbox) Push(ctx context.Context, userID string, item InboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	key := inboxKey(userID)
+	cutoff := time.Now().Add(-i.ttl).UnixMilli()
+	pipe := i.client.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(item.CreatedAt.UnixMilli()), Member: data})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(cutoff, 10))
+	// Keep only the newest max entries.
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-i.max-1))
+	pipe.Expire(ctx, key, i.ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (i *redisInbox) List(ctx context.Context, userID string) ([]InboxItem, error) {
+	raw, err := i.client.ZRangeByScore(ctx, inboxKey(userID), i.liveRange()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeInboxItems(raw), nil
+}
+
+func (i *redisInbox) Drain(ctx context.Context, userID string) ([]InboxItem, error) {
+	key := inboxKey(userID)
+	pipe := i.client.TxPipeline()
+	items := pipe.ZRangeByScore(ctx, key, i.liveRange())
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return decodeInboxItems(items.Val()), nil
+}
+
+func (i *redisInbox) Purge(ctx context.Context, userID string) (int, error) {
+	key := inboxKey(userID)
+	pipe := i.client.TxPipeline()
+	count := pipe.ZCard(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+func (i *redisInbox) liveRange() *redis.ZRangeBy {
+	cutoff := time.Now().Add(-i.ttl).UnixMilli()
+	return &redis.ZRangeBy{Min: strconv.FormatInt(cutoff, 10), Max: "+inf"}
+}
+
+// memoryInbox is the single-node fallback when Redis is unavailable.
+type memoryInbox struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	items map[string][]InboxItem
+}
+
+// NewMemoryInbox returns a process-local inbox that is lost on restart.
+func NewMemoryInbox(ttl time.Duration, max int) Inbox {
+	return &memoryInbox{ttl: ttl, max: max, items: make(map[string][]InboxItem)}
+}
+
+func (i *memoryInbox) Push(_ context.Context, userID string, item InboxItem) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	items := append(i.live(userID), item)
+	if len(items) > i.max {
+		items = items[len(items)-i.max:]
+	}
+	i.items[userID] = items
+	return nil
+}
+
+func (i *memoryInbox) List(_ context.Context, userID string) ([]InboxItem, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	items := i.live(userID)
+	return append([]InboxItem(nil), items...), nil
+}
+
+func (i *memoryInbox) Drain(_ context.Context, userID string) ([]InboxItem, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	items := i.live(userID)
+	delete(i.items, userID)
+	return items, nil
+}
+
+func (i *memoryInbox) Purge(_ context.Context, userID string) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	count := len(i.live(userID))
+	delete(i.items, userID)
+	return count, nil
+}
+
+// live drops expired items for the user; callers must hold the lock.
+func (i *memoryInbox) live(userID string) []InboxItem {
+	items := i.items[userID]
+	cutoff := time.Now().Add(-i.ttl)
+	start := 0
+	for start < len(items) && items[start].CreatedAt.Before(cutoff) {
+		start++
+	}
+	items = items[start:]
+	if len(items) == 0 {
+		delete(i.items, userID)
+		return nil
+	}
+	i.items[userID] = items
+	return items
+}
+
+// InboxItems lists pending notifications for an offline user.
+func (h *Hub) InboxItems(ctx context.Context, userID string) ([]InboxItem, error) {
+	if h.inbox == nil {
+		return nil, ErrInboxDisabled
+	}
+	return h.inbox.List(ctx, userID)
+}
+
+// PurgeInbox drops all pending notifications for a user.
+func (h *Hub) PurgeInbox(ctx context.Context, userID string) (int, error) {
+	if h.inbox == nil {
+		return 0, ErrInboxDisabled
+	}
+	return h.inbox.Purge(ctx, userID)
+}
+
+// queueOffline stores a payload when no node has the user connected.
+func (h *Hub) queueOffline(userID, id string, payload []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if h.redis != nil {
+		// Every node holding a connection for the user subscribes to its channel.
+		subscribers, err := h.numSub(ctx, h.userChannel(userID))
+		if err != nil {
+			log.Printf("redis numsub user=%s failed: %v", userID, err)
+			return
+		}
+		if subscribers > 0 {
+			return
+		}
+	}
+	h.storeOffline(ctx, userID, id, payload)
+}
+
+// storeOffline pushes a payload into the user's inbox.
+func (h *Hub) storeOffline(ctx context.Context, userID, id string, payload []byte) {
+	item := InboxItem{ID: id, Payload: string(payload), CreatedAt: time.Now().UTC()}
+	if err := h.inbox.Push(ctx, userID, item); err != nil {
+		log.Printf("inbox push user=%s failed: %v", userID, err)
+	}
+}
+
+// drainInbox replays queued notifications to a freshly connected client.
+func (h *Hub) drainInbox(client *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	items, err := h.inbox.Drain(ctx, client.id)
+	if err != nil {
+		log.Printf("inbox drain user=%s failed: %v", client.id, err)
+		return
+	}
+	for _, item := range items {
+		msg := h.newMessage([]byte(item.Payload))
+		msg.id = item.ID
+		msg.client = client
+		h.enqueue(msg)
+	}
+}
+
+func decodeInboxItems(raw []string) []InboxItem {
+	items := make([]InboxItem, 0, len(raw))
+	for _, entry := range raw {
+		var item InboxItem
+		if err := json.Unmarshal([]byte(entry), &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func inboxKey(userID string) string {
+	return "ws:inbox:" + userID
+}
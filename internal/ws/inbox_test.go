@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"go-playground/internal/memredis"
+)
+
+func startMemredis(t *testing.T) *memredis.Server {
+	t.Helper()
+	server := memredis.New()
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("start memredis: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
+
+// checkInbox runs the behavior both inbox implementations share: oldest
+// first, capped at max entries, expired entries dropped, purge and drain.
+func checkInbox(t *testing.T, inbox Inbox) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	push := func(user, id string, at time.Time) {
+		t.Helper()
+		if err := inbox.Push(ctx, user, InboxItem{ID: id, Payload: "p-" + id, CreatedAt: at}); err != nil {
+			t.Fatalf("push %s: %v", id, err)
+		}
+	}
+	ids := func(items []InboxItem, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("read inbox: %v", err)
+		}
+		out := ""
+		for _, item := range items {
+			out += item.ID + ","
+		}
+		return out
+	}
+
+	push("alice", "stale", now.Add(-2*time.Hour))
+	for i := 1; i <= 4; i++ {
+		push("alice", strconv.Itoa(i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if got := ids(inbox.List(ctx, "alice")); got != "2,3,4," {
+		t.Fatalf("list = %q, want newest 3 oldest first", got)
+	}
+	if got := ids(inbox.List(ctx, "alice")); got != "2,3,4," {
+		t.Fatalf("list removed items: %q", got)
+	}
+	if got := ids(inbox.Drain(ctx, "alice")); got != "2,3,4," {
+		t.Fatalf("drain = %q", got)
+	}
+	if got := ids(inbox.Drain(ctx, "alice")); got != "" {
+		t.Fatalf("second drain = %q, want empty", got)
+	}
+
+	push("bob", "1", now)
+	push("bob", "2", now.Add(time.Millisecond))
+	if n, err := inbox.Purge(ctx, "bob"); err != nil || n != 2 {
+		t.Fatalf("purge = %d, %v; want 2", n, err)
+	}
+	if got := ids(inbox.List(ctx, "bob")); got != "" {
+		t.Fatalf("list after purge = %q", got)
+	}
+}
+
+func TestMemoryInbox(t *testing.T) {
+	checkInbox(t, NewMemoryInbox(time.Hour, 3))
+}
+
+func TestRedisInbox(t *testing.T) {
+	server := startMemredis(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	checkInbox(t, NewRedisInbox(client, time.Hour, 3))
+}
+
+func TestHubReplaysInboxInOrder(t *testing.T) {
+	t.Setenv("INBOX_ENABLED", "true")
+	server := startMemredis(t)
+	hub := NewHub(WithRedisConfig(RedisConfig{Mode: RedisModeSingle, Addrs: []string{server.Addr()}}))
+	go hub.Run()
+	t.Cleanup(hub.Close)
+
+	// Offline pushes run off the hub goroutine and are ordered by creation
+	// time, so queue each one before sending the next.
+	for i, payload := range []string{"one", "two", "three"} {
+		hub.SendToUser("carol", []byte(payload))
+		waitInbox(t, hub, "carol", i+1)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	client := &Client{send: make(chan []byte, 8), id: "carol", group: "default", ip: "127.0.0.1"}
+	hub.register <- client
+	for _, want := range []string{"one", "two", "three"} {
+		select {
+		case got := <-client.send:
+			if string(got) != want {
+				t.Fatalf("replayed %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	items, err := hub.InboxItems(context.Background(), "carol")
+	if err != nil || len(items) != 0 {
+		t.Fatalf("inbox after replay = %v, %v; want empty", items, err)
+	}
+}
+
+func waitInbox(t *testing.T, hub *Hub, userID string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		items, err := hub.InboxItems(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("inbox items: %v", err)
+		}
+		if len(items) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d items, want %d", len(items), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,369 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// connSetPrefix namespaces the per-user sorted sets of open connections
+	// used for cluster-wide limits.
+	connSetPrefix = "ws:conns:"
+	// memberSetPrefix namespaces the per-group sorted sets of open
+	// connections, kept for groups whose policy sets MaxMembers.
+	memberSetPrefix = "ws:members:"
+	// connSlotTTL is how long a connection's slot survives without a
+	// heartbeat, so a crashed node's connections stop counting.
+	connSlotTTL = 60 * time.Second
+)
+
+var (
+	// ErrTooManyConnections is returned when a user or IP is at its limit
+	// under LimitReject.
+	ErrTooManyConnections = errors.New("too many connections")
+	// ErrNodeFull is returned when the node is at its connection limit.
+	ErrNodeFull = errors.New("node at connection limit")
+)
+
+// LimitPolicy decides what happens when a user or IP is at its limit.
+type LimitPolicy string
+
+const (
+	// LimitReject refuses the new connection.
+	LimitReject LimitPolicy = "reject"
+	// LimitEvictOldest closes the oldest connections to make room.
+	LimitEvictOldest LimitPolicy = "evict-oldest"
+)
+
+// Limits caps open connections. Zero values are unlimited.
+type Limits struct {
+	// PerUser and PerIP cap this node's connections for one id or address.
+	PerUser int
+	PerIP   int
+	// ClusterPerUser caps one id's connections across every node sharing the
+	// backplane. Joins racing on different nodes may briefly exceed it.
+	ClusterPerUser int
+	// Node caps this node's connections; it always rejects, and /readyz
+	// fails while the node is full.
+	Node int
+	// Policy applies to the per-user, per-IP and cluster limits.
+	Policy LimitPolicy
+	// TrustProxy takes the client address from the last X-Forwarded-For
+	// hop, the one appended by the proxy in front of the node. Earlier hops
+	// come from the client and are ignored. Only safe behind such a proxy.
+	TrustProxy bool
+}
+
+// LimitsFromEnv reads the CONN_* variables.
+func LimitsFromEnv() (Limits, error) {
+	limits := Limits{Policy: LimitReject}
+	for name, target := range map[string]*int{
+		"CONN_MAX_PER_USER":         &limits.PerUser,
+		"CONN_MAX_PER_IP":           &limits.PerIP,
+		"CONN_MAX_PER_USER_CLUSTER": &limits.ClusterPerUser,
+		"CONN_MAX_NODE":             &limits.Node,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return limits, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*target = n
+		}
+	}
+	if raw := os.Getenv("CONN_LIMIT_POLICY"); raw != "" {
+		limits.Policy = LimitPolicy(raw)
+	}
+	if raw := os.Getenv("CONN_TRUST_PROXY"); raw != "" {
+		trust, err := strconv.ParseBool(raw)
+		if err != nil {
+			return limits, fmt.Errorf("invalid CONN_TRUST_PROXY %q", raw)
+		}
+		limits.TrustProxy = trust
+	}
+	return limits, limits.Validate()
+}
+
+// Validate rejects unknown policies and negative limits.
+func (l Limits) Validate() error {
+	switch l.Policy {
+	case "", LimitReject, LimitEvictOldest:
+	default:
+		return fmt.Errorf("unknown connection limit policy %q (want %s or %s)", l.Policy, LimitReject, LimitEvictOldest)
+	}
+	if l.PerUser < 0 || l.PerIP < 0 || l.ClusterPerUser < 0 || l.Node < 0 {
+		return errors.New("connection limits must not be negative")
+	}
+	return nil
+}
+
+// WithLimits caps connections per user, per IP, per node and per user
+// across the cluster.
+func WithLimits(limits Limits) Option {
+	return func(h *Hub) {
+		h.limits = limits
+	}
+}
+
+// AtCapacity reports an error while the node holds its maximum number of
+// connections, so readiness fails and balancers route elsewhere.
+func (h *Hub) AtCapacity(context.Context) error {
+	if h.limits.Node <= 0 {
+		return nil
+	}
+	count := 0
+	if !h.do(func() { count = h.connections }) {
+		return ErrHubClosed
+	}
+	if count >= h.limits.Node {
+		return fmt.Errorf("%w: %d of %d", ErrNodeFull, count, h.limits.Node)
+	}
+	return nil
+}
+
+// admission is the room a new connection needs under LimitEvictOldest:
+// local connections and cluster slots to evict once it has registered.
+type admission struct {
+	userID  string
+	victims []*Client
+	slots   []string
+}
+
+// admit checks a new connection against the limits. It evicts nothing;
+// makeRoom does that once the connection has upgraded and registered, so
+// a failed handshake never kicks existing sessions.
+func (h *Hub) admit(ctx context.Context, userID, ip string) (admission, error) {
+	a := admission{userID: userID}
+	var err error
+	h.do(func() {
+		if h.limits.Node > 0 && h.connections >= h.limits.Node {
+			err = fmt.Errorf("%w: %d connections", ErrNodeFull, h.connections)
+			return
+		}
+		var byUser, byIP []*Client
+		if byUser, err = h.overLimit(h.clientsByUser[userID], h.limits.PerUser, "user "+userID); err != nil {
+			return
+		}
+		if byIP, err = h.overLimit(h.clientsByIP[ip], h.limits.PerIP, "address "+ip); err != nil {
+			return
+		}
+		a.victims = append(byUser, byIP...)
+	})
+	if err != nil {
+		return admission{}, err
+	}
+	if a.slots, err = h.admitCluster(ctx, userID); err != nil {
+		return admission{}, err
+	}
+	return a, nil
+}
+
+// makeRoom closes the local connections and asks other nodes to close the
+// cluster slots an admitted connection displaced.
+func (h *Hub) makeRoom(ctx context.Context, a admission) {
+	if len(a.victims) > 0 {
+		h.do(func() {
+			for _, c := range a.victims {
+				h.evict(c)
+			}
+		})
+	}
+	key := connSetPrefix + a.userID
+	for _, slot := range a.slots {
+		_, connKey, _ := strings.Cut(slot, "|")
+		if err := h.redis.ZRem(ctx, key, slot).Err(); err != nil {
+			log.Printf("redis connection limit user=%s failed: %v", a.userID, err)
+		}
+		data, err := encodeEnvelope(broadcastMessage{id: connKey, source: h.instanceID, sentAt: time.Now().UTC(), userID: a.userID, evict: connKey})
+		if err != nil {
+			continue
+		}
+		if _, err := h.publish(ctx, h.userChannel(a.userID), data); err != nil {
+			log.Printf("redis evict user=%s conn=%s failed: %v", a.userID, connKey, err)
+		}
+	}
+}
+
+// overLimit returns the oldest connections to evict so one more fits under
+// max, or an error under LimitReject.
+func (h *Hub) overLimit(clients map[*Client]struct{}, max int, what string) ([]*Client, error) {
+	if max <= 0 || len(clients) < max {
+		return nil, nil
+	}
+	if h.limits.Policy != LimitEvictOldest {
+		return nil, fmt.Errorf("%w: %s has %d (max %d)", ErrTooManyConnections, what, len(clients), max)
+	}
+	oldest := make([]*Client, 0, len(clients))
+	for c := range clients {
+		oldest = append(oldest, c)
+	}
+	sort.Slice(oldest, func(i, j int) bool { return oldest[i].connectedAt.Before(oldest[j].connectedAt) })
+	return oldest[:len(clients)-max+1], nil
+}
+
+// evict closes a connection to make room; it runs on the hub goroutine.
+func (h *Hub) evict(c *Client) {
+	if h.detach(c) {
+		c.evicted.Store(true)
+		close(c.send)
+	}
+}
+
+// evictByKey evicts the local connection with the given key, if any. Other
+// nodes ask for it through the user's channel.
+func (h *Hub) evictByKey(userID, key string) {
+	h.do(func() {
+		for c := range h.clientsByUser[userID] {
+			if c.key == key {
+				log.Printf("ws evicting user=%s conn=%s for cluster limit", userID, key)
+				h.evict(c)
+			}
+		}
+	})
+}
+
+// admitCluster applies ClusterPerUser using the user's connection set and
+// returns the oldest slots to evict under LimitEvictOldest. Redis errors
+// let the connection through rather than locking users out.
+func (h *Hub) admitCluster(ctx context.Context, userID string) ([]string, error) {
+	max := h.limits.ClusterPerUser
+	if max <= 0 || h.redis == nil {
+		return nil, nil
+	}
+	key := connSetPrefix + userID
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := h.redis.ZRemRangeByScore(ctx, key, "-inf", now).Err(); err != nil {
+		log.Printf("redis connection limit user=%s failed: %v", userID, err)
+		return nil, nil
+	}
+	slots, err := h.redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Result()
+	if err != nil {
+		log.Printf("redis connection limit user=%s failed: %v", userID, err)
+		return nil, nil
+	}
+	if len(slots) < max {
+		return nil, nil
+	}
+	if h.limits.Policy != LimitEvictOldest {
+		return nil, fmt.Errorf("%w: user %s has %d across the cluster (max %d)", ErrTooManyConnections, userID, len(slots), max)
+	}
+	// Slots start with the zero-padded connect time, so they sort oldest first.
+	sort.Strings(slots)
+	return slots[:len(slots)-max+1], nil
+}
+
+// slot is the connection's member in its user's connection set.
+func (c *Client) slot() string {
+	return fmt.Sprintf("%020d|%s", c.connectedAt.UnixNano(), c.key)
+}
+
+// slotKeys lists the sets a connection's slot is kept in: its user's for
+// the cluster-wide user limit and its group's when the group is capped.
+func (h *Hub) slotKeys(c *Client) []string {
+	var keys []string
+	if h.limits.ClusterPerUser > 0 {
+		keys = append(keys, connSetPrefix+c.id)
+	}
+	if policy, _ := h.acl.Policy(c.group); policy.MaxMembers > 0 {
+		keys = append(keys, memberSetPrefix+c.group)
+	}
+	return keys
+}
+
+// claimSlots records connections in their sets with a fresh expiry.
+func (h *Hub) claimSlots(ctx context.Context, clients ...*Client) {
+	if h.redis == nil || len(clients) == 0 {
+		return
+	}
+	expires := float64(time.Now().Add(connSlotTTL).UnixMilli())
+	pipe := h.redis.Pipeline()
+	for _, c := range clients {
+		for _, key := range h.slotKeys(c) {
+			pipe.ZAdd(ctx, key, redis.Z{Score: expires, Member: c.slot()})
+			pipe.PExpire(ctx, key, 2*connSlotTTL)
+		}
+	}
+	if pipe.Len() == 0 {
+		return
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("redis connection slots failed: %v", err)
+	}
+}
+
+// releaseSlot removes a closed connection from its sets.
+func (h *Hub) releaseSlot(c *Client) {
+	if h.redis == nil {
+		return
+	}
+	ctx := context.Background()
+	for _, key := range h.slotKeys(c) {
+		if err := h.redis.ZRem(ctx, key, c.slot()).Err(); err != nil {
+			log.Printf("redis connection slot release key=%s failed: %v", key, err)
+		}
+	}
+}
+
+// liveSlots drops expired slots from key and counts the rest.
+func (h *Hub) liveSlots(ctx context.Context, key string) (int64, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := h.redis.ZRemRangeByScore(ctx, key, "-inf", now).Err(); err != nil {
+		return 0, err
+	}
+	return h.redis.ZCard(ctx, key).Result()
+}
+
+// refreshSlots keeps this node's slots alive until the hub closes.
+func (h *Hub) refreshSlots() {
+	ticker := time.NewTicker(connSlotTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		var clients []*Client
+		h.do(func() {
+			for _, byUser := range h.clientsByUser {
+				for c := range byUser {
+					clients = append(clients, c)
+				}
+			}
+		})
+		h.claimSlots(context.Background(), clients...)
+	}
+}
+
+// clientIP returns the address limits are counted against.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		// Proxies append, so only the rightmost hop is not client supplied.
+		hops := r.Header.Values("X-Forwarded-For")
+		if len(hops) > 0 {
+			last := hops[len(hops)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if last = strings.TrimSpace(last); last != "" {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,11 @@
+package ws
+
+// Option customizes a Hub at construction time.
+type Option func(*Hub)
+
+// WithRedisConfig uses an explicit backplane config instead of REDIS_* variables.
+func WithRedisConfig(cfg RedisConfig) Option {
+	return func(h *Hub) {
+		h.redisConfig = &cfg
+	}
+}
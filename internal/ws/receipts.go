@@ -0,0 +1,196 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultReceiptTTL bounds how long delivery receipts stay queryable in Redis.
+const defaultReceiptTTL = 10 * time.Minute
+
+// Delivery states reported per user and per node.
+const (
+	DeliveryPending      = "pending"
+	DeliveryDelivered    = "delivered"
+	DeliveryNoConnection = "no_connection"
+)
+
+// receiptMeta is stored once per notification when it is published.
+type receiptMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"`
+	Users     []string  `json:"users"`
+}
+
+// NodeDelivery is what a single node reported for one user.
+type NodeDelivery struct {
+	Status      string    `json:"status"`
+	Connections int       `json:"connections"`
+	ReportedAt  time.Time `json:"reported_at"`
+}
+
+// UserDelivery aggregates node reports for one recipient.
+type UserDelivery struct {
+	Status    string                  `json:"status"`
+	Receivers int64                   `json:"receivers"`
+	Nodes     map[string]NodeDelivery `json:"nodes"`
+}
+
+// NotificationStatus is the cluster-wide delivery view of a notification.
+type NotificationStatus struct {
+	ID        string                  `json:"id"`
+	CreatedAt time.Time               `json:"created_at"`
+	Source    string                  `json:"source"`
+	Users     map[string]UserDelivery `json:"users"`
+}
+
+// NotificationStatus loads and aggregates delivery receipts for a notification id.
+func (h *Hub) NotificationStatus(ctx context.Context, id string) (*NotificationStatus, error) {
+	if h.redis == nil {
+		return nil, ErrRedisUnavailable
+	}
+	fields, err := h.redis.HGetAll(ctx, receiptKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	rawMeta, ok := fields["meta"]
+	if !ok {
+		return nil, ErrNotificationNotFound
+	}
+	var meta receiptMeta
+	if err := json.Unmarshal([]byte(rawMeta), &meta); err != nil {
+		return nil, err
+	}
+
+	status := &NotificationStatus{
+		ID:        id,
+		CreatedAt: meta.CreatedAt,
+		Source:    meta.Source,
+		Users:     make(map[string]UserDelivery, len(meta.Users)),
+	}
+	receivers := make(map[string]int64)
+	for _, userID := range meta.Users {
+		status.Users[userID] = UserDelivery{Status: DeliveryPending, Nodes: make(map[string]NodeDelivery)}
+	}
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, "receivers:"):
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			receivers[strings.TrimPrefix(field, "receivers:")] = count
+		case strings.HasPrefix(field, "node:"):
+			// Field layout is node:<node id>:<user id>; node ids never contain ':'.
+			rest := strings.TrimPrefix(field, "node:")
+			node, userID, ok := strings.Cut(rest, ":")
+			if !ok {
+				continue
+			}
+			var report NodeDelivery
+			if err := json.Unmarshal([]byte(value), &report); err != nil {
+				continue
+			}
+			user, ok := status.Users[userID]
+			if !ok {
+				continue
+			}
+			user.Nodes[node] = report
+			status.Users[userID] = user
+		}
+	}
+
+	for userID, user := range status.Users {
+		count, published := receivers[userID]
+		if published {
+			user.Receivers = count
+		}
+		user.Status = aggregateDelivery(user, published)
+		status.Users[userID] = user
+	}
+	return status, nil
+}
+
+// aggregateDelivery folds node reports into a single user-level status.
+func aggregateDelivery(user UserDelivery, published bool) string {
+	for _, report := range user.Nodes {
+		if report.Status == DeliveryDelivered {
+			return DeliveryDelivered
+		}
+	}
+	if !published {
+		return DeliveryPending
+	}
+	// Every subscribed node answered without a live connection, or nobody was subscribed.
+	if int64(len(user.Nodes)) >= user.Receivers {
+		return DeliveryNoConnection
+	}
+	return DeliveryPending
+}
+
+// startReceipt stores notification metadata before the payload is published.
+func (h *Hub) startReceipt(ctx context.Context, id string, userIDs []string) error {
+	users := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != "" {
+			users = append(users, userID)
+		}
+	}
+	data, err := json.Marshal(receiptMeta{CreatedAt: time.Now().UTC(), Source: h.instanceID, Users: users})
+	if err != nil {
+		return err
+	}
+	key := receiptKey(id)
+	pipe := h.redis.TxPipeline()
+	pipe.HSet(ctx, key, "meta", data)
+	pipe.Expire(ctx, key, h.receiptTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// recordReceivers stores how many nodes were subscribed when the publish happened.
+func (h *Hub) recordReceivers(ctx context.Context, id, userID string, receivers int64) error {
+	return h.redis.HSet(ctx, receiptKey(id), "receivers:"+userID, receivers).Err()
+}
+
+// recordDelivery reports this node's local delivery result for a notification.
+func (h *Hub) recordDelivery(id, userID string, connections int) {
+	if h.redis == nil {
+		return
+	}
+	report := NodeDelivery{Status: DeliveryDelivered, Connections: connections, ReportedAt: time.Now().UTC()}
+	if connections == 0 {
+		report.Status = DeliveryNoConnection
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	key := receiptKey(id)
+	pipe := h.redis.TxPipeline()
+	pipe.HSet(ctx, key, "node:"+h.instanceID+":"+userID, data)
+	pipe.Expire(ctx, key, h.receiptTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("redis receipt report id=%s user=%s failed: %v", id, userID, err)
+	}
+}
+
+func newNotificationID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return newInstanceID()
+	}
+	return hex.EncodeToString(buf)
+}
+
+func receiptKey(id string) string {
+	return "ws:receipt:" + id
+}
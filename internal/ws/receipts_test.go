@@ -0,0 +1,26 @@
+package ws
+
+import "testing"
+
+func TestAggregateDelivery(t *testing.T) {
+	delivered := NodeDelivery{Status: DeliveryDelivered, Connections: 1}
+	missed := NodeDelivery{Status: DeliveryNoConnection}
+	cases := []struct {
+		name      string
+		user      UserDelivery
+		published bool
+		want      string
+	}{
+		{"not yet published", UserDelivery{}, false, DeliveryPending},
+		{"nobody subscribed", UserDelivery{Receivers: 0}, true, DeliveryNoConnection},
+		{"awaiting a node", UserDelivery{Receivers: 2, Nodes: map[string]NodeDelivery{"a": missed}}, true, DeliveryPending},
+		{"every node missed", UserDelivery{Receivers: 2, Nodes: map[string]NodeDelivery{"a": missed, "b": missed}}, true, DeliveryNoConnection},
+		{"any node delivered", UserDelivery{Receivers: 2, Nodes: map[string]NodeDelivery{"a": missed, "b": delivered}}, true, DeliveryDelivered},
+		{"local delivery before publish count", UserDelivery{Nodes: map[string]NodeDelivery{"a": delivered}}, false, DeliveryDelivered},
+	}
+	for _, tc := range cases {
+		if got := aggregateDelivery(tc.user, tc.published); got != tc.want {
+			t.Errorf("%s: status = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
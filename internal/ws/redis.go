@@ -0,0 +1,171 @@
+package ws
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis deployment modes accepted by RedisConfig.
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// RedisConfig describes how the hub reaches its Redis backplane.
+type RedisConfig struct {
+	// Mode is single, sentinel or cluster.
+	Mode string
+	// Addrs lists the server, sentinel or cluster seed addresses.
+	Addrs []string
+	// MasterName is the monitored master in sentinel mode.
+	MasterName string
+	Username   string
+	Password   string
+	// SentinelPassword authenticates against the sentinels themselves.
+	SentinelPassword string
+	// DB selects the logical database; cluster mode only supports 0.
+	DB int
+	// TLS enables TLS; TLSInsecure skips certificate verification for local setups.
+	TLS         bool
+	TLSInsecure bool
+	// Channel is the cross-node broadcast channel.
+	Channel string
+	// Sharded switches pub/sub to SPUBLISH/SSUBSCRIBE (Redis 7 cluster).
+	Sharded bool
+}
+
+// RedisConfigFromEnv reads the backplane config from REDIS_* variables.
+// REDIS_ADDR is kept for single-node setups; REDIS_ADDRS takes a list.
+func RedisConfigFromEnv() (RedisConfig, error) {
+	cfg := RedisConfig{
+		Mode:             strings.ToLower(os.Getenv("REDIS_MODE")),
+		MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		Channel:          os.Getenv("REDIS_CHANNEL"),
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = RedisModeSingle
+	}
+	if raw := os.Getenv("REDIS_ADDRS"); raw != "" {
+		for _, addr := range strings.Split(raw, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Addrs = append(cfg.Addrs, addr)
+			}
+		}
+	} else if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		cfg.Addrs = []string{addr}
+	}
+	if len(cfg.Addrs) == 0 {
+		// Default to localhost for local multi-node testing.
+		cfg.Addrs = []string{"localhost:6379"}
+	}
+	if cfg.Channel == "" {
+		cfg.Channel = "ws:broadcast"
+	}
+
+	var err error
+	if cfg.DB, err = envInt("REDIS_DB"); err != nil {
+		return cfg, err
+	}
+	if cfg.TLS, err = envBool("REDIS_TLS"); err != nil {
+		return cfg, err
+	}
+	if cfg.TLSInsecure, err = envBool("REDIS_TLS_INSECURE"); err != nil {
+		return cfg, err
+	}
+	if cfg.Sharded, err = envBool("REDIS_SHARDED"); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports configuration mistakes before any connection is made.
+func (c RedisConfig) Validate() error {
+	if len(c.Addrs) == 0 {
+		return errors.New("redis: no addresses configured")
+	}
+	switch c.Mode {
+	case RedisModeSingle:
+		if len(c.Addrs) > 1 {
+			return errors.New("redis: single mode takes exactly one address")
+		}
+	case RedisModeSentinel:
+		if c.MasterName == "" {
+			return errors.New("redis: sentinel mode requires REDIS_MASTER_NAME")
+		}
+	case RedisModeCluster:
+		if c.DB != 0 {
+			return errors.New("redis: cluster mode only supports DB 0")
+		}
+	default:
+		return fmt.Errorf("redis: unknown mode %q", c.Mode)
+	}
+	if c.Sharded && c.Mode != RedisModeCluster {
+		return errors.New("redis: sharded pub/sub requires cluster mode")
+	}
+	return nil
+}
+
+// NewClient builds the go-redis client matching the configured mode.
+func (c RedisConfig) NewClient() (redis.UniversalClient, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	opts := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		DB:               c.DB,
+	}
+	if c.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: c.TLSInsecure}
+	}
+	switch c.Mode {
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+// String describes the target without credentials, for logs.
+func (c RedisConfig) String() string {
+	return fmt.Sprintf("%s %s", c.Mode, strings.Join(c.Addrs, ","))
+}
+
+func envInt(name string) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, raw, err)
+	}
+	return value, nil
+}
+
+func envBool(name string) (bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", name, raw, err)
+	}
+	return value, nil
+}
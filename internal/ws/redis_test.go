@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     RedisConfig
+		wantErr string
+	}{
+		{"single", RedisConfig{Mode: RedisModeSingle, Addrs: []string{"a:6379"}}, ""},
+		{"no addresses", RedisConfig{Mode: RedisModeSingle}, "no addresses"},
+		{"single with two addresses", RedisConfig{Mode: RedisModeSingle, Addrs: []string{"a:6379", "b:6379"}}, "exactly one address"},
+		{"sentinel", RedisConfig{Mode: RedisModeSentinel, Addrs: []string{"a:26379", "b:26379"}, MasterName: "mymaster"}, ""},
+		{"sentinel without master", RedisConfig{Mode: RedisModeSentinel, Addrs: []string{"a:26379"}}, "REDIS_MASTER_NAME"},
+		{"cluster sharded", RedisConfig{Mode: RedisModeCluster, Addrs: []string{"a:7000", "b:7001"}, Sharded: true}, ""},
+		{"cluster with db", RedisConfig{Mode: RedisModeCluster, Addrs: []string{"a:7000"}, DB: 2}, "only supports DB 0"},
+		{"sharded outside cluster", RedisConfig{Mode: RedisModeSingle, Addrs: []string{"a:6379"}, Sharded: true}, "requires cluster mode"},
+		{"unknown mode", RedisConfig{Mode: "ring", Addrs: []string{"a:6379"}}, "unknown mode"},
+	}
+	for _, tc := range cases {
+		err := tc.cfg.Validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestRedisConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_MODE", "Cluster")
+	t.Setenv("REDIS_ADDRS", "a:7000, b:7001,")
+	t.Setenv("REDIS_SHARDED", "true")
+	cfg, err := RedisConfigFromEnv()
+	if err != nil {
+		t.Fatalf("from env: %v", err)
+	}
+	if cfg.Mode != RedisModeCluster || strings.Join(cfg.Addrs, ",") != "a:7000,b:7001" || !cfg.Sharded || cfg.Channel != "ws:broadcast" {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	t.Setenv("REDIS_SHARDED", "maybe")
+	if _, err := RedisConfigFromEnv(); err == nil {
+		t.Fatal("invalid REDIS_SHARDED accepted")
+	}
+}
+
+func TestRedisConfigNewClient(t *testing.T) {
+	single := RedisConfig{Mode: RedisModeSingle, Addrs: []string{"a:6379"}, Username: "app", Password: "secret", DB: 3, TLS: true, TLSInsecure: true}
+	client, err := single.NewClient()
+	if err != nil {
+		t.Fatalf("single: %v", err)
+	}
+	defer client.Close()
+	opts := client.(*redis.Client).Options()
+	if opts.Addr != "a:6379" || opts.Username != "app" || opts.Password != "secret" || opts.DB != 3 {
+		t.Fatalf("single options = %+v", opts)
+	}
+	if opts.TLSConfig == nil || !opts.TLSConfig.InsecureSkipVerify {
+		t.Fatalf("single TLS = %+v", opts.TLSConfig)
+	}
+	if strings.Contains(single.String(), "secret") {
+		t.Fatalf("String leaks the password: %s", single)
+	}
+
+	cluster, err := RedisConfig{Mode: RedisModeCluster, Addrs: []string{"a:7000", "b:7001"}, Password: "secret"}.NewClient()
+	if err != nil {
+		t.Fatalf("cluster: %v", err)
+	}
+	defer cluster.Close()
+	if opts := cluster.(*redis.ClusterClient).Options(); len(opts.Addrs) != 2 || opts.Password != "secret" || opts.TLSConfig != nil {
+		t.Fatalf("cluster options = %+v", opts)
+	}
+
+	sentinel, err := RedisConfig{Mode: RedisModeSentinel, Addrs: []string{"a:26379"}, MasterName: "mymaster"}.NewClient()
+	if err != nil {
+		t.Fatalf("sentinel: %v", err)
+	}
+	defer sentinel.Close()
+	if _, ok := sentinel.(*redis.Client); !ok {
+		t.Fatalf("sentinel client = %T, want a failover *redis.Client", sentinel)
+	}
+
+	if _, err := (RedisConfig{Mode: RedisModeSentinel, Addrs: []string{"a:26379"}}).NewClient(); err == nil {
+		t.Fatal("invalid config built a client")
+	}
+}
@@ -0,0 +1,198 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// Clients call server methods over their socket with
+//
+//	{"type":"rpc","id":"1","method":"echo","params":{...}}
+//
+// and get exactly one reply on the same connection, either
+//
+//	{"type":"rpc_result","id":"1","result":...}
+//	{"type":"rpc_error","id":"1","error":{"code":"timeout","message":"..."}}
+//
+// RPC frames are never broadcast.
+
+const (
+	rpcType       = "rpc"
+	rpcResultType = "rpc_result"
+	rpcErrorType  = "rpc_error"
+
+	defaultRPCTimeout = 10 * time.Second
+	// maxRPCInFlight bounds concurrent calls per connection.
+	maxRPCInFlight = 32
+)
+
+// RPC error codes sent to clients.
+const (
+	RPCBadRequest     = "bad_request"
+	RPCMethodNotFound = "method_not_found"
+	RPCTimeout        = "timeout"
+	RPCTooManyCalls   = "too_many_calls"
+	RPCInternal       = "internal"
+)
+
+// RPCError is returned by handlers to send a specific code to the client;
+// any other error is reported as RPCInternal.
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// RPCCall is one client request.
+type RPCCall struct {
+	ID     string
+	Method string
+	Params json.RawMessage
+	Client *Client
+}
+
+// RPCHandler serves a method. ctx expires at the call timeout, when the
+// client already gets a timeout error; handlers must return promptly once
+// it is done, since a call keeps its in-flight slot until the handler
+// returns.
+type RPCHandler func(ctx context.Context, call *RPCCall) (any, error)
+
+// WithRPC registers a handler for method.
+func WithRPC(method string, handler RPCHandler) Option {
+	return func(h *Hub) {
+		if h.rpcHandlers == nil {
+			h.rpcHandlers = make(map[string]RPCHandler)
+		}
+		h.rpcHandlers[method] = handler
+	}
+}
+
+// WithRPCTimeout sets how long a handler may run before the client gets a
+// timeout error.
+func WithRPCTimeout(d time.Duration) Option {
+	return func(h *Hub) {
+		h.rpcTimeout = d
+	}
+}
+
+// rpcFrame is the wire shape of requests and replies.
+type rpcFrame struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result any             `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// parseRPC reports whether frame is an RPC request and decodes it. Cheap
+// checks come first so ordinary chat frames skip JSON decoding.
+func parseRPC(frame []byte) (rpcFrame, bool) {
+	var req rpcFrame
+	trimmed := bytes.TrimSpace(frame)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"rpc"`)) {
+		return req, false
+	}
+	if json.Unmarshal(trimmed, &req) != nil || req.Type != rpcType {
+		return req, false
+	}
+	return req, true
+}
+
+// handleRPC runs the call off the read loop and replies to the caller only.
+func (h *Hub) handleRPC(c *Client, req rpcFrame) {
+	if req.ID == "" || req.Method == "" {
+		h.replyRPC(c, rpcFrame{Type: rpcErrorType, ID: req.ID, Error: &RPCError{Code: RPCBadRequest, Message: "id and method are required"}})
+		return
+	}
+	handler, ok := h.rpcHandlers[req.Method]
+	if !ok {
+		h.replyRPC(c, rpcFrame{Type: rpcErrorType, ID: req.ID, Error: &RPCError{Code: RPCMethodNotFound, Message: "unknown method " + req.Method}})
+		return
+	}
+	select {
+	case c.rpcSlots <- struct{}{}:
+	default:
+		h.replyRPC(c, rpcFrame{Type: rpcErrorType, ID: req.ID, Error: &RPCError{Code: RPCTooManyCalls, Message: "too many calls in flight"}})
+		return
+	}
+
+	go func() {
+		timeout := h.rpcTimeout
+		if timeout <= 0 {
+			timeout = defaultRPCTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		call := &RPCCall{ID: req.ID, Method: req.Method, Params: req.Params, Client: c}
+		type outcome struct {
+			result any
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			// The slot is held until the handler returns, not until the
+			// client is answered, so handlers that ignore ctx cannot pile up.
+			defer func() { <-c.rpcSlots }()
+			var out outcome
+			out.err = &RPCError{Code: RPCInternal, Message: "handler panicked"}
+			safely("rpc "+req.Method, func() { out.result, out.err = handler(ctx, call) })
+			done <- out
+		}()
+
+		timedOut := rpcFrame{Type: rpcErrorType, ID: req.ID, Error: &RPCError{Code: RPCTimeout, Message: "call exceeded " + timeout.String()}}
+		reply := rpcFrame{Type: rpcResultType, ID: req.ID}
+		select {
+		case out := <-done:
+			switch {
+			case errors.Is(out.err, context.DeadlineExceeded):
+				reply = timedOut
+			case out.err != nil:
+				reply = rpcFrame{Type: rpcErrorType, ID: req.ID, Error: toRPCError(out.err)}
+			default:
+				reply.Result = out.result
+			}
+		case <-ctx.Done():
+			reply = timedOut
+		}
+		h.replyRPC(c, reply)
+	}()
+}
+
+func toRPCError(err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &RPCError{Code: RPCInternal, Message: err.Error()}
+}
+
+// replyRPC writes a reply to one connection from the hub goroutine, which
+// owns the send channel.
+func (h *Hub) replyRPC(c *Client, reply rpcFrame) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		data, _ = json.Marshal(rpcFrame{Type: rpcErrorType, ID: reply.ID, Error: &RPCError{Code: RPCInternal, Message: "result not encodable"}})
+		log.Printf("ws rpc %s result not encodable: %v", reply.ID, err)
+	}
+	h.sendDirect(c, data)
+}
+
+// sendDirect delivers a frame to a single tracked connection.
+func (h *Hub) sendDirect(c *Client, frame []byte) bool {
+	sent := false
+	h.do(func() {
+		if _, ok := h.clientsByUser[c.id][c]; ok {
+			sent = h.trySend(c, frame)
+		}
+	})
+	return sent
+}
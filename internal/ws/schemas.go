@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go-playground/internal/schema"
+)
+
+// Typed frames are JSON objects with a string "type". When a schema is
+// registered for that type the frame must match it before it is broadcast;
+// otherwise the sender alone gets
+//
+//	{"type":"error","ref":"<frame id>","error":{"code":"invalid_message",
+//	 "message":"...","details":[{"path":"/text","message":"..."}]}}
+//
+// Plain text frames and types without a schema pass through unchanged.
+// While any schema is registered, frames that start like a JSON object but
+// do not parse, or whose "type" is not a string, get the same error.
+
+// frameError is the error object of an error frame.
+type frameError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details []schema.Error `json:"details,omitempty"`
+}
+
+// errorFrame tells a client why one of its frames was not accepted. Ref
+// echoes the frame's "id" when it had one.
+type errorFrame struct {
+	Type  string     `json:"type"`
+	Ref   string     `json:"ref,omitempty"`
+	Error frameError `json:"error"`
+}
+
+// sendError writes an error frame to one connection.
+func (h *Hub) sendError(c *Client, problem frameError, ref string) {
+	data, _ := json.Marshal(errorFrame{Type: "error", Ref: ref, Error: problem})
+	h.sendDirect(c, data)
+}
+
+// WithSchemas validates inbound frames of each message type against its
+// schema.
+func WithSchemas(schemas map[string]*schema.Schema) Option {
+	return func(h *Hub) {
+		if h.schemas == nil {
+			h.schemas = make(map[string]*schema.Schema, len(schemas))
+		}
+		for messageType, s := range schemas {
+			h.schemas[messageType] = s
+		}
+	}
+}
+
+// validateFrame checks a typed frame against its schema and returns the
+// problem to report, or nil when the frame may be broadcast.
+func (h *Hub) validateFrame(frame []byte) (*frameError, string) {
+	if len(h.schemas) == 0 {
+		return nil, ""
+	}
+	trimmed := bytes.TrimSpace(frame)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, ""
+	}
+	var head struct {
+		Type json.RawMessage `json:"type"`
+		ID   any             `json:"id"`
+	}
+	if json.Unmarshal(trimmed, &head) != nil {
+		return &frameError{Code: "invalid_message", Message: "frame is not valid JSON"}, ""
+	}
+	if head.Type == nil {
+		return nil, ""
+	}
+	var messageType string
+	if json.Unmarshal(head.Type, &messageType) != nil {
+		ref, _ := head.ID.(string)
+		return &frameError{Code: "invalid_message", Message: `frame "type" must be a string`}, ref
+	}
+	s, ok := h.schemas[messageType]
+	if !ok {
+		return nil, ""
+	}
+	ref, _ := head.ID.(string)
+	if errs := s.ValidateJSON(trimmed); len(errs) > 0 {
+		return &frameError{Code: "invalid_message", Message: "frame does not match the " + messageType + " schema", Details: errs}, ref
+	}
+	return nil, ""
+}
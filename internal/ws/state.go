@@ -0,0 +1,253 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ephemeral state (typing, cursor position, "viewing" markers) is a message
+// class of its own. Clients set a key for their group with
+//
+//	{"type":"state","key":"typing","value":true,"ttl_ms":3000}
+//
+// and a null value clears it. Updates are coalesced per group: every flush
+// interval the group receives at most one frame holding the latest value
+// of each changed key,
+//
+//	{"type":"state","group":"team","states":[{"user":"alpha","key":"typing","value":true,"ttl_ms":3000}]}
+//
+// with "value":null for keys that were cleared, expired or whose owner
+// disconnected. State is never stored, replayed or passed to message hooks,
+// and a recipient whose send buffer is busy skips a frame instead of being
+// dropped.
+
+const (
+	stateType = "state"
+
+	defaultStateFlush = 100 * time.Millisecond
+	defaultStateTTL   = 5 * time.Second
+	maxStateTTL       = 30 * time.Second
+	// maxStateKeys bounds the keys one user may hold per group.
+	maxStateKeys = 16
+	// maxStateValue bounds the encoded size of one value.
+	maxStateValue = 1024
+)
+
+// stateFrame is both the client update and, with States, the fan-out frame.
+type stateFrame struct {
+	Type   string          `json:"type"`
+	Group  string          `json:"group,omitempty"`
+	Key    string          `json:"key,omitempty"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	TTLMS  int64           `json:"ttl_ms,omitempty"`
+	States []stateUpdate   `json:"states,omitempty"`
+}
+
+// stateUpdate is one key in a fan-out frame.
+type stateUpdate struct {
+	User    string          `json:"user"`
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	TTLMS   int64           `json:"ttl_ms,omitempty"`
+	Expired bool            `json:"expired,omitempty"`
+}
+
+// stateSlot identifies one key of one user in a group.
+type stateSlot struct {
+	user string
+	key  string
+}
+
+type stateEntry struct {
+	value   json.RawMessage
+	ttl     time.Duration
+	expires time.Time
+	dirty   bool
+}
+
+// stateTable holds live state per group and the changes awaiting a flush.
+type stateTable struct {
+	mu     sync.Mutex
+	flush  time.Duration
+	ttl    time.Duration
+	groups map[string]map[stateSlot]*stateEntry
+	// cleared collects keys removed since the last flush.
+	cleared map[string][]stateUpdate
+}
+
+// WithStateTiming sets how often coalesced state is flushed and how long a
+// key lives when the client gives no ttl_ms. Non-positive values keep the
+// defaults.
+func WithStateTiming(flush, ttl time.Duration) Option {
+	return func(h *Hub) {
+		if flush > 0 {
+			h.state.flush = flush
+		}
+		if ttl > 0 {
+			h.state.ttl = ttl
+		}
+	}
+}
+
+// parseState reports whether frame is a state update and decodes it.
+func parseState(frame []byte) (stateFrame, bool) {
+	var update stateFrame
+	trimmed := bytes.TrimSpace(frame)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"state"`)) {
+		return update, false
+	}
+	if json.Unmarshal(trimmed, &update) != nil || update.Type != stateType {
+		return update, false
+	}
+	return update, true
+}
+
+// setState records a client's update for the next flush.
+func (h *Hub) setState(c *Client, update stateFrame) {
+	if update.Key == "" {
+		h.sendError(c, frameError{Code: "invalid_state", Message: "key is required"}, "")
+		return
+	}
+	if len(update.Value) > maxStateValue {
+		h.sendError(c, frameError{Code: "invalid_state", Message: "value is too large"}, "")
+		return
+	}
+	slot := stateSlot{user: c.id, key: update.Key}
+	clear := len(update.Value) == 0 || string(update.Value) == "null"
+
+	s := &h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group := s.groups[c.group]
+	if clear {
+		if _, ok := group[slot]; ok {
+			delete(group, slot)
+			s.cleared[c.group] = append(s.cleared[c.group], stateUpdate{User: c.id, Key: update.Key, Value: json.RawMessage("null")})
+		}
+		return
+	}
+	if group == nil {
+		group = make(map[stateSlot]*stateEntry)
+		s.groups[c.group] = group
+	}
+	if _, ok := group[slot]; !ok && s.userKeys(group, c.id) >= maxStateKeys {
+		h.sendError(c, frameError{Code: "invalid_state", Message: "too many state keys"}, "")
+		return
+	}
+	ttl := s.ttl
+	if update.TTLMS > 0 {
+		ttl = min(time.Duration(update.TTLMS)*time.Millisecond, maxStateTTL)
+	}
+	group[slot] = &stateEntry{value: update.Value, ttl: ttl, expires: time.Now().Add(ttl), dirty: true}
+}
+
+// userKeys counts a user's keys in a group; callers hold the lock.
+func (s *stateTable) userKeys(group map[stateSlot]*stateEntry, userID string) int {
+	n := 0
+	for slot := range group {
+		if slot.user == userID {
+			n++
+		}
+	}
+	return n
+}
+
+// clearStates drops a departing connection's keys unless the user still
+// has another local connection in the group.
+func (h *Hub) clearStates(c *Client) {
+	stillHere := false
+	h.do(func() {
+		for other := range h.clientsByUser[c.id] {
+			stillHere = stillHere || other.group == c.group
+		}
+	})
+	if stillHere {
+		return
+	}
+	s := &h.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for slot := range s.groups[c.group] {
+		if slot.user == c.id {
+			delete(s.groups[c.group], slot)
+			s.cleared[c.group] = append(s.cleared[c.group], stateUpdate{User: c.id, Key: slot.key, Value: json.RawMessage("null")})
+		}
+	}
+}
+
+// runStateFlusher sends coalesced state every flush interval until the hub
+// closes.
+func (h *Hub) runStateFlusher() {
+	ticker := time.NewTicker(h.state.flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			for group, updates := range h.state.collect(time.Now()) {
+				payload, err := json.Marshal(stateFrame{Type: stateType, Group: group, States: updates})
+				if err != nil {
+					continue
+				}
+				msg := h.newMessage(payload)
+				msg.group = group
+				msg.ephemeral = true
+				h.enqueue(msg)
+			}
+		}
+	}
+}
+
+// collect returns the changed, cleared and expired keys per group and
+// resets the change tracking.
+func (s *stateTable) collect(now time.Time) map[string][]stateUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]stateUpdate)
+	for group, updates := range s.cleared {
+		out[group] = append(out[group], updates...)
+	}
+	clear(s.cleared)
+	for group, entries := range s.groups {
+		for slot, entry := range entries {
+			switch {
+			case now.After(entry.expires):
+				delete(entries, slot)
+				out[group] = append(out[group], stateUpdate{User: slot.user, Key: slot.key, Value: json.RawMessage("null"), Expired: true})
+			case entry.dirty:
+				entry.dirty = false
+				out[group] = append(out[group], stateUpdate{User: slot.user, Key: slot.key, Value: entry.value, TTLMS: entry.ttl.Milliseconds()})
+			}
+		}
+		if len(entries) == 0 {
+			delete(s.groups, group)
+		}
+	}
+	for _, updates := range out {
+		sort.Slice(updates, func(i, j int) bool {
+			if updates[i].User != updates[j].User {
+				return updates[i].User < updates[j].User
+			}
+			return updates[i].Key < updates[j].Key
+		})
+	}
+	return out
+}
+
+// trySendEphemeral queues a frame only when the client's buffer has room
+// to spare, so state never crowds out or drops a connection.
+func trySendEphemeral(client *Client, payload []byte) bool {
+	if len(client.send) >= cap(client.send)/2 {
+		return false
+	}
+	select {
+	case client.send <- payload:
+		return true
+	default:
+		return false
+	}
+}
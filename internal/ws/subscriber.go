@@ -0,0 +1,290 @@
+package ws
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// userChannelPrefix namespaces per-user Redis channels.
+	userChannelPrefix = "ws:user:"
+	// userChannelShards bounds how many hash slots user channels occupy in
+	// sharded mode, and therefore how many PubSub connections a node opens.
+	userChannelShards = 16
+	// broadcastSubscription keys the PubSub that carries the broadcast channel.
+	broadcastSubscription = "broadcast"
+)
+
+// subscriptionQueue hands channel changes from the hub loop to the
+// subscriber without blocking. Only the latest wanted state per channel is
+// kept, so a burst of connects and disconnects coalesces while Redis is
+// slow instead of stalling fan-out.
+type subscriptionQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	wake    chan struct{}
+}
+
+func newSubscriptionQueue() *subscriptionQueue {
+	return &subscriptionQueue{pending: make(map[string]bool), wake: make(chan struct{}, 1)}
+}
+
+// request records whether channel should be subscribed and wakes the
+// subscriber.
+func (q *subscriptionQueue) request(channel string, subscribe bool) {
+	q.mu.Lock()
+	q.pending[channel] = subscribe
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the pending changes.
+func (q *subscriptionQueue) take() map[string]bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changes := q.pending
+	q.pending = make(map[string]bool)
+	return changes
+}
+
+// startRedisSubscriber opens the node's multiplexed PubSub connection.
+//
+// The broadcast channel and every per-user channel share one connection and
+// one reader goroutine; user channels are added and removed with dynamic
+// SUBSCRIBE/UNSUBSCRIBE as users come and go. PSUBSCRIBE on ws:user:* was
+// rejected because every node would then receive every user message, and
+// PUBLISH receiver counts (used for receipts and the offline inbox) would
+// no longer mean "nodes holding this user".
+//
+// Sharded pub/sub only allows one hash slot per connection, so user channels
+// carry a {sN} hash tag and get one PubSub per tag instead.
+func (h *Hub) startRedisSubscriber() {
+	ctx := context.Background()
+	h.replyChannel = replyChannelPrefix + h.instanceID
+	h.openSubscription(ctx, h.subscriptionKey(h.redisChannel), h.redisChannel)
+	// Unsharded, the reply channel joins the broadcast PubSub.
+	h.applySubscription(ctx, h.replyChannel, true)
+	go h.applySubscriptionChanges(ctx)
+}
+
+// openSubscription creates a PubSub for key with an initial channel and
+// starts its reader goroutine.
+func (h *Hub) openSubscription(ctx context.Context, key, channel string) {
+	var pubsub *redis.PubSub
+	if h.sharded {
+		pubsub = h.redis.SSubscribe(ctx, channel)
+	} else {
+		pubsub = h.redis.Subscribe(ctx, channel)
+	}
+	h.pubsubs[key] = pubsub
+
+	ch := pubsub.Channel(redis.WithChannelSize(1024))
+	go func() {
+		for msg := range ch {
+			if msg.Channel == h.redisChannel {
+				h.handleBroadcastMessage(msg.Payload)
+				continue
+			}
+			if msg.Channel == h.replyChannel {
+				h.handleReplyMessage(msg.Payload)
+				continue
+			}
+			if userID, ok := h.userIDFromChannel(msg.Channel); ok {
+				h.handleUserMessage(userID, msg.Payload)
+			}
+		}
+	}()
+}
+
+// applySubscriptionChanges serializes SUBSCRIBE/UNSUBSCRIBE so the hub loop
+// never blocks on Redis; each channel ends in its latest requested state.
+func (h *Hub) applySubscriptionChanges(ctx context.Context) {
+	defer close(h.subscriberDone)
+	for {
+		select {
+		case <-h.done:
+			for _, pubsub := range h.pubsubs {
+				_ = pubsub.Close()
+			}
+			return
+		case <-h.subQueue.wake:
+		}
+		for channel, subscribe := range h.subQueue.take() {
+			h.applySubscription(ctx, channel, subscribe)
+		}
+	}
+}
+
+// applySubscription adds or drops one channel on its PubSub connection.
+func (h *Hub) applySubscription(ctx context.Context, channel string, subscribe bool) {
+	key := h.subscriptionKey(channel)
+	pubsub, ok := h.pubsubs[key]
+	if !ok {
+		if subscribe {
+			h.openSubscription(ctx, key, channel)
+		}
+		return
+	}
+	var err error
+	switch {
+	case subscribe && h.sharded:
+		err = pubsub.SSubscribe(ctx, channel)
+	case subscribe:
+		err = pubsub.Subscribe(ctx, channel)
+	case h.sharded:
+		err = pubsub.SUnsubscribe(ctx, channel)
+	default:
+		err = pubsub.Unsubscribe(ctx, channel)
+	}
+	if err != nil {
+		log.Printf("redis subscription change channel=%s subscribe=%t failed: %v", channel, subscribe, err)
+	}
+}
+
+// subscriptionKey picks which PubSub connection carries a channel.
+func (h *Hub) subscriptionKey(channel string) string {
+	if !h.sharded {
+		return ""
+	}
+	if channel == h.redisChannel {
+		return broadcastSubscription
+	}
+	if channel == h.replyChannel {
+		return replySubscription
+	}
+	userID, _ := h.userIDFromChannel(channel)
+	return userShardTag(userID)
+}
+
+// handleBroadcastMessage fans envelopes from other nodes into the local hub.
+func (h *Hub) handleBroadcastMessage(data string) {
+	out, err := decodeEnvelope([]byte(data))
+	if err != nil {
+		log.Printf("redis broadcast decode failed: %v", err)
+		return
+	}
+	if out.source == h.instanceID {
+		return
+	}
+	if out.sync == syncGroups {
+		go h.syncGroupPolicies(context.Background())
+		return
+	}
+	h.enqueue(out)
+}
+
+// handleUserMessage delivers a per-user channel message to local connections.
+func (h *Hub) handleUserMessage(userID, data string) {
+	out, err := decodeEnvelope([]byte(data))
+	if err != nil {
+		// Plain PUBLISH from redis-cli still reaches the user as-is.
+		out = h.newMessage([]byte(data))
+		out.remote = true
+	}
+	if out.call != nil {
+		h.forwardCall(userID, *out.call)
+		return
+	}
+	if out.evict != "" {
+		h.evictByKey(userID, out.evict)
+		return
+	}
+	// The channel, not the envelope, decides who receives it.
+	out.userID = userID
+	out.group, out.groups, out.topic, out.all = "", nil, "", false
+	log.Printf("redis user message user=%s id=%s source=%s", userID, out.id, out.source)
+	h.enqueue(out)
+}
+
+// ensureUserSubscription adds the user's channel on the first local connection.
+func (h *Hub) ensureUserSubscription(userID string) {
+	if h.redis == nil || userID == "" {
+		return
+	}
+	h.userSubs[userID]++
+	if h.userSubs[userID] == 1 {
+		h.subQueue.request(h.userChannel(userID), true)
+	}
+}
+
+// releaseUserSubscription drops the user's channel after the last local connection.
+func (h *Hub) releaseUserSubscription(userID string) {
+	if h.redis == nil || userID == "" {
+		return
+	}
+	count, ok := h.userSubs[userID]
+	if !ok {
+		return
+	}
+	if count > 1 {
+		h.userSubs[userID] = count - 1
+		return
+	}
+	delete(h.userSubs, userID)
+	h.subQueue.request(h.userChannel(userID), false)
+}
+
+// publish sends to a channel with PUBLISH or SPUBLISH and returns the receiver count.
+func (h *Hub) publish(ctx context.Context, channel string, data []byte) (int64, error) {
+	if h.sharded {
+		return h.redis.SPublish(ctx, channel, data).Result()
+	}
+	return h.redis.Publish(ctx, channel, data).Result()
+}
+
+// numSub reports how many connections are subscribed to a channel.
+func (h *Hub) numSub(ctx context.Context, channel string) (int64, error) {
+	var counts map[string]int64
+	var err error
+	if h.sharded {
+		counts, err = h.redis.PubSubShardNumSub(ctx, channel).Result()
+	} else {
+		counts, err = h.redis.PubSubNumSub(ctx, channel).Result()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return counts[channel], nil
+}
+
+// userChannel names the per-user channel, hash-tagged when sharded.
+func (h *Hub) userChannel(userID string) string {
+	if h.sharded {
+		return userChannelPrefix + userShardTag(userID) + ":" + userID
+	}
+	return userChannelPrefix + userID
+}
+
+// UserChannel names the backplane channel carrying a user's messages.
+func (h *Hub) UserChannel(userID string) string {
+	return h.userChannel(userID)
+}
+
+// userIDFromChannel reverses userChannel.
+func (h *Hub) userIDFromChannel(channel string) (string, bool) {
+	rest, ok := strings.CutPrefix(channel, userChannelPrefix)
+	if !ok {
+		return "", false
+	}
+	if h.sharded {
+		_, userID, ok := strings.Cut(rest, ":")
+		return userID, ok
+	}
+	return rest, true
+}
+
+// userShardTag maps a user to one of userChannelShards hash tags.
+func userShardTag(userID string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(userID))
+	return "{s" + strconv.Itoa(int(hash.Sum32()%userChannelShards)) + "}"
+}
@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-playground/internal/memredis"
+)
+
+// BenchmarkHubUserDelivery measures per-user delivery through the real
+// subscriber: one hub publishes to users that are all connected to a second
+// hub, and each iteration waits for the frame to reach the client's send
+// queue. It reports how many PubSub connections the receiving hub holds.
+// It runs against REDIS_ADDR when set and against the in-memory stand-in
+// otherwise; WS_BENCH_USERS sets the user count (default 10k).
+//
+//	go test ./internal/ws -run '^$' -bench HubUserDelivery -benchtime 2000x
+func BenchmarkHubUserDelivery(b *testing.B) {
+	addr := os.Getenv("REDIS_ADDR")
+	var server *memredis.Server
+	if addr == "" {
+		server = memredis.New()
+		if err := server.Start("127.0.0.1:0"); err != nil {
+			b.Fatalf("start memredis: %v", err)
+		}
+		b.Cleanup(func() { _ = server.Close() })
+		addr = server.Addr()
+	}
+	cfg := RedisConfig{Mode: RedisModeSingle, Addrs: []string{addr}, Channel: "ws:bench:" + newInstanceID()}
+	sender := benchHub(b, cfg)
+	receiver := benchHub(b, cfg)
+
+	users := benchUsers()
+	clients := make([]*Client, users)
+	for i := range clients {
+		clients[i] = &Client{send: make(chan []byte, 1), id: "bench-" + strconv.Itoa(i), group: "bench", ip: "127.0.0.1"}
+		receiver.register <- clients[i]
+	}
+	waitSubscribed(b, receiver, clients)
+
+	var pubsubs int
+	receiver.do(func() { pubsubs = len(receiver.pubsubs) })
+	payload := []byte(`{"type":"bench"}`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client := clients[i%users]
+		sender.SendToUser(client.id, payload)
+		select {
+		case <-client.send:
+		case <-time.After(5 * time.Second):
+			b.Fatalf("delivery to %s timed out", client.id)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(pubsubs), "pubsub-conns")
+	if server != nil {
+		// Counts the subscriber connections of both hubs.
+		b.ReportMetric(float64(server.Subscribers()), "backplane-subscribers")
+	}
+}
+
+func benchHub(b *testing.B, cfg RedisConfig) *Hub {
+	b.Helper()
+	hub := NewHub(WithRedisConfig(cfg))
+	if hub.redis == nil {
+		b.Skipf("redis unavailable at %s", cfg.Addrs[0])
+	}
+	go hub.Run()
+	b.Cleanup(hub.Close)
+	return hub
+}
+
+// waitSubscribed blocks until the hub's subscriber has applied every
+// client's user channel.
+func waitSubscribed(b *testing.B, hub *Hub, clients []*Client) {
+	b.Helper()
+	ctx := context.Background()
+	deadline := time.Now().Add(time.Minute)
+	const batch = 500
+	for start := 0; start < len(clients); start += batch {
+		channels := make([]string, 0, batch)
+		for _, client := range clients[start:min(start+batch, len(clients))] {
+			channels = append(channels, hub.userChannel(client.id))
+		}
+		for {
+			counts, err := hub.redis.PubSubNumSub(ctx, channels...).Result()
+			if err != nil {
+				b.Fatalf("numsub: %v", err)
+			}
+			missing := 0
+			for _, channel := range channels {
+				if counts[channel] == 0 {
+					missing++
+				}
+			}
+			if missing == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				b.Fatalf("%d user channels still unsubscribed", missing)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func benchUsers() int {
+	if n, err := strconv.Atoi(os.Getenv("WS_BENCH_USERS")); err == nil && n > 0 {
+		return n
+	}
+	return 10000
+}
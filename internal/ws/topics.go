@@ -0,0 +1,45 @@
+package ws
+
+import "strings"
+
+// splitTopics parses a comma-separated topic list, dropping empty entries.
+func splitTopics(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	topics := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		topic := strings.TrimSpace(part)
+		if topic == "" {
+			continue
+		}
+		if _, ok := seen[topic]; ok {
+			continue
+		}
+		seen[topic] = struct{}{}
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// matchTopic reports whether a dot-separated topic matches the pattern.
+// "*" matches exactly one segment and a trailing ">" matches one or more
+// remaining segments, so "orders.*" matches "orders.created" but not
+// "orders.eu.created", while "orders.>" matches both.
+func matchTopic(pattern, topic string) bool {
+	patternParts := strings.Split(pattern, ".")
+	topicParts := strings.Split(topic, ".")
+	for i, part := range patternParts {
+		if part == ">" && i == len(patternParts)-1 {
+			return len(topicParts) > i
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "*" && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(topicParts)
+}
@@ -0,0 +1,38 @@
+package ws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.updated", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*", "orders", false},
+		{"*.created", "billing.created", true},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"orders.>.created", "orders.>.created", true},
+	}
+	for _, tc := range cases {
+		if got := matchTopic(tc.pattern, tc.topic); got != tc.want {
+			t.Errorf("matchTopic(%q, %q) = %v, want %v", tc.pattern, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestSplitTopics(t *testing.T) {
+	if got := strings.Join(splitTopics(" a, b,,a ,c"), "|"); got != "a|b|c" {
+		t.Fatalf("splitTopics = %q", got)
+	}
+	if splitTopics("") != nil {
+		t.Fatal("empty list should be nil")
+	}
+}
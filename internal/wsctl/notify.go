@@ -0,0 +1,43 @@
+package wsctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NotifyUser calls POST /notify/user on the node at base and returns the
+// response body.
+func NotifyUser(ctx context.Context, base, userID, message string) ([]byte, error) {
+	return post(ctx, base, "/notify/user", url.Values{"id": {userID}, "message": {message}})
+}
+
+// NotifyRedis calls POST /notify/redis, which fans out to every node the
+// users are connected to, and returns the response body.
+func NotifyRedis(ctx context.Context, base string, userIDs []string, message string) ([]byte, error) {
+	return post(ctx, base, "/notify/redis", url.Values{"ids": {strings.Join(userIDs, ",")}, "message": {message}})
+}
+
+func post(ctx context.Context, base, path string, query url.Values) ([]byte, error) {
+	target := strings.TrimRight(base, "/") + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("wsctl: %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("wsctl: %s: %w", path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return body, fmt.Errorf("wsctl: %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
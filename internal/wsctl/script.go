@@ -0,0 +1,98 @@
+package wsctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultExpectTimeout bounds expect steps unless a script sets its own.
+const DefaultExpectTimeout = 2 * time.Second
+
+// step is one parsed script line.
+type step struct {
+	line    int
+	verb    string
+	text    string
+	pattern *regexp.Regexp
+	wait    time.Duration
+}
+
+// parseScript reads a script without running it.
+func parseScript(r io.Reader) ([]step, error) {
+	var steps []step
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		verb, text, _ := strings.Cut(raw, " ")
+		s := step{line: n, verb: verb, text: strings.TrimSpace(text)}
+		switch verb {
+		case "send", "expect":
+		case "match":
+			pattern, err := regexp.Compile(s.text)
+			if err != nil {
+				return nil, fmt.Errorf("wsctl: line %d: %w", n, err)
+			}
+			s.pattern = pattern
+		case "timeout", "sleep":
+			wait, err := time.ParseDuration(s.text)
+			if err != nil {
+				return nil, fmt.Errorf("wsctl: line %d: %w", n, err)
+			}
+			s.wait = wait
+		default:
+			return nil, fmt.Errorf("wsctl: line %d: unknown directive %q", n, verb)
+		}
+		steps = append(steps, s)
+	}
+	return steps, scanner.Err()
+}
+
+// RunScript executes a script on the connection, logging each step to log.
+// Scripts are line-oriented; blank lines and lines starting with # are
+// ignored. Directives:
+//
+//	send TEXT        send TEXT as a frame
+//	expect TEXT      the next frame must equal TEXT
+//	match REGEXP     the next frame must match REGEXP
+//	timeout DURATION wait this long for later expect/match steps
+//	sleep DURATION   pause
+//
+// Failures name the script line.
+func (c *Conn) RunScript(r io.Reader, log io.Writer) error {
+	steps, err := parseScript(r)
+	if err != nil {
+		return err
+	}
+	timeout := DefaultExpectTimeout
+	for _, s := range steps {
+		switch s.verb {
+		case "send":
+			if err := c.Send(s.text); err != nil {
+				return fmt.Errorf("wsctl: line %d: send: %w", s.line, err)
+			}
+			fmt.Fprintf(log, "> %s\n", s.text)
+		case "expect", "match":
+			frame, err := c.Next(timeout)
+			if err != nil {
+				return fmt.Errorf("wsctl: line %d: %w", s.line, err)
+			}
+			got := string(frame)
+			if (s.pattern == nil && got != s.text) || (s.pattern != nil && !s.pattern.MatchString(got)) {
+				return fmt.Errorf("wsctl: line %d: got %q, want %s %q", s.line, got, s.verb, s.text)
+			}
+			fmt.Fprintf(log, "< %s\n", got)
+		case "timeout":
+			timeout = s.wait
+		case "sleep":
+			time.Sleep(s.wait)
+		}
+	}
+	return nil
+}
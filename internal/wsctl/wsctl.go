@@ -0,0 +1,154 @@
+// Package wsctl is a terminal client for the hub: it holds a websocket
+// connection for debugging, runs scripted send/expect sessions and wraps
+// the notify endpoints so operators can push from a shell.
+package wsctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn is a websocket connection to one node with buffered reads.
+type Conn struct {
+	conn   *websocket.Conn
+	frames chan []byte
+	err    error
+}
+
+// Dial connects to base (http[s]:// or ws[s]:// node address) as id/group.
+// Extra query values such as topics or debug are passed through.
+func Dial(ctx context.Context, base, id, group string, extra url.Values) (*Conn, error) {
+	target, err := WebSocketURL(base)
+	if err != nil {
+		return nil, err
+	}
+	query := target.Query()
+	for key, values := range extra {
+		query[key] = values
+	}
+	query.Set("id", id)
+	if group != "" {
+		query.Set("group", group)
+	}
+	target.RawQuery = query.Encode()
+
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("wsctl: dial %s: %w", target.Redacted(), err)
+	}
+	c := &Conn{conn: ws, frames: make(chan []byte, 256)}
+	go c.readLoop()
+	return c, nil
+}
+
+// WebSocketURL resolves a node address to its /ws endpoint.
+func WebSocketURL(base string) (*url.URL, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("wsctl: invalid address %q: %w", base, err)
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("wsctl: unsupported scheme in %q", base)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/ws"
+	}
+	return u, nil
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.frames)
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.frames <- msg
+	}
+}
+
+// Send writes one text frame.
+func (c *Conn) Send(payload string) error {
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(payload))
+}
+
+// Next returns the next frame, or an error when the connection closes or
+// nothing arrives within timeout.
+func (c *Conn) Next(timeout time.Duration) ([]byte, error) {
+	select {
+	case frame, ok := <-c.frames:
+		if !ok {
+			return nil, fmt.Errorf("wsctl: connection closed: %v", c.err)
+		}
+		return frame, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("wsctl: no frame within %s", timeout)
+	}
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *Conn) Close() error {
+	_ = c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.conn.Close()
+}
+
+// Interactive sends each line of in as a frame and prints incoming frames
+// to out until in is exhausted, the server closes, or ctx is cancelled.
+func (c *Conn) Interactive(ctx context.Context, in io.Reader, out io.Writer) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if err := c.Send(line); err != nil {
+				return fmt.Errorf("wsctl: send: %w", err)
+			}
+		case frame, ok := <-c.frames:
+			if !ok {
+				return fmt.Errorf("wsctl: connection closed: %v", c.err)
+			}
+			fmt.Fprintln(out, Pretty(frame))
+		}
+	}
+}
+
+// Pretty indents JSON frames and returns other frames unchanged.
+func Pretty(frame []byte) string {
+	var buf bytes.Buffer
+	if json.Valid(frame) && json.Indent(&buf, frame, "", "  ") == nil {
+		return buf.String()
+	}
+	return string(frame)
+}
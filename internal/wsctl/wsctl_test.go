@@ -0,0 +1,51 @@
+package wsctl_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"go-playground/internal/wsctl"
+	"go-playground/internal/wstest"
+)
+
+func TestScriptAndNotify(t *testing.T) {
+	cluster := wstest.NewCluster(t, 2)
+	node0, node1 := cluster.Node(0), cluster.Node(1)
+	ctx := context.Background()
+
+	conn, err := wsctl.Dial(ctx, node0.URL, "alice", "ops", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	node0.WaitConnections(t, "alice", 1)
+	cluster.WaitUserSubscribed(t, "alice", 1)
+
+	script := `
+# group echo comes back to the sender
+send hello
+expect hello
+timeout 1s
+`
+	if err := conn.RunScript(strings.NewReader(script), io.Discard); err != nil {
+		t.Fatalf("script: %v", err)
+	}
+
+	if _, err := wsctl.NotifyUser(ctx, node0.URL, "alice", "direct"); err != nil {
+		t.Fatalf("notify user: %v", err)
+	}
+	// Publishing from the other node proves the Redis path.
+	if _, err := wsctl.NotifyRedis(ctx, node1.URL, []string{"alice"}, "via redis"); err != nil {
+		t.Fatalf("notify redis: %v", err)
+	}
+	if err := conn.RunScript(strings.NewReader("expect direct\nmatch ^via redis$\n"), io.Discard); err != nil {
+		t.Fatalf("notifications: %v", err)
+	}
+
+	err = conn.RunScript(strings.NewReader("send ping\nexpect pong\n"), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("mismatch error = %v, want failure on line 2", err)
+	}
+}
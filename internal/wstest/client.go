@@ -0,0 +1,136 @@
+package wstest
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client is a test websocket connection that buffers received frames.
+type Client struct {
+	conn   *websocket.Conn
+	frames chan []byte
+	closed chan struct{}
+}
+
+// Dial connects to the node as id/group and waits until the hub has
+// registered the connection, so messages sent right after are not missed.
+// Extra query values (topics, debug, ...) are passed through.
+func (n *Node) Dial(t testing.TB, id, group string, extra url.Values) *Client {
+	t.Helper()
+	client := n.dial(t, id, group, extra)
+	go client.readLoop()
+	return client
+}
+
+// DialStalled connects like Dial but never reads, so the server-side send
+// buffer eventually fills and the hub drops the connection.
+func (n *Node) DialStalled(t testing.TB, id, group string, extra url.Values) *Client {
+	t.Helper()
+	return n.dial(t, id, group, extra)
+}
+
+func (n *Node) dial(t testing.TB, id, group string, extra url.Values) *Client {
+	t.Helper()
+	query := url.Values{}
+	for key, values := range extra {
+		query[key] = values
+	}
+	query.Set("id", id)
+	query.Set("group", group)
+
+	hub := n.Server.Hub()
+	before := hub.UserConnections(id)
+	conn, _, err := websocket.DefaultDialer.Dial(n.WSURL(query), nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", n.URL, err)
+	}
+	client := &Client{conn: conn, frames: make(chan []byte, 1024), closed: make(chan struct{})}
+	t.Cleanup(client.Close)
+	waitFor(t, DefaultTimeout, func() bool {
+		return hub.UserConnections(id) > before
+	}, "hub to register %s", id)
+	return client
+}
+
+func (c *Client) readLoop() {
+	defer close(c.frames)
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.frames <- msg
+	}
+}
+
+// Send writes a text frame.
+func (c *Client) Send(t testing.TB, payload string) {
+	t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(payload)); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+// Next returns the next frame or fails after timeout.
+func (c *Client) Next(t testing.TB, timeout time.Duration) []byte {
+	t.Helper()
+	select {
+	case frame, ok := <-c.frames:
+		if !ok {
+			t.Fatalf("connection closed while waiting for a frame")
+		}
+		return frame
+	case <-time.After(timeout):
+		t.Fatalf("no frame within %s", timeout)
+		return nil
+	}
+}
+
+// Expect fails unless the next frame equals want.
+func (c *Client) Expect(t testing.TB, want string) {
+	t.Helper()
+	if got := string(c.Next(t, DefaultTimeout)); got != want {
+		t.Fatalf("frame = %q, want %q", got, want)
+	}
+}
+
+// ExpectNone fails if any frame arrives within d.
+func (c *Client) ExpectNone(t testing.TB, d time.Duration) {
+	t.Helper()
+	select {
+	case frame, ok := <-c.frames:
+		if ok {
+			t.Fatalf("unexpected frame %q", frame)
+		}
+	case <-time.After(d):
+	}
+}
+
+// ExpectClosed fails unless the server closes the connection within timeout.
+func (c *Client) ExpectClosed(t testing.TB, timeout time.Duration) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-c.frames:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("connection still open after %s", timeout)
+		}
+	}
+}
+
+// Close closes the connection; it is safe to call more than once.
+func (c *Client) Close() {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+		_ = c.conn.Close()
+	}
+}
@@ -0,0 +1,914 @@
+package wstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go-playground/internal/httpserver"
+	"go-playground/internal/schema"
+	"go-playground/internal/ws"
+)
+
+func TestGroupFanoutAcrossNodes(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	sender := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	peer := cluster.Node(1).Dial(t, "beta", "team", nil)
+	outsider := cluster.Node(1).Dial(t, "gamma", "other", nil)
+
+	sender.Send(t, "hello")
+
+	sender.Expect(t, "hello")
+	peer.Expect(t, "hello")
+	outsider.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestOnePubSubPerNode(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	cluster.Node(0).Dial(t, "alpha", "team", nil)
+	cluster.Node(1).Dial(t, "beta", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 1)
+	cluster.WaitUserSubscribed(t, "beta", 1)
+
+	// Broadcast, reply and user channels all share one connection per node.
+	time.Sleep(100 * time.Millisecond)
+	if n := cluster.Backplane.Subscribers(); n != 2 {
+		t.Fatalf("pub/sub connections = %d, want 1 per node", n)
+	}
+}
+
+func TestUserSubscriptionFollowsConnections(t *testing.T) {
+	cluster := NewCluster(t, 1)
+	node := cluster.Node(0)
+	channel := node.Server.Hub().UserChannel("alpha")
+	first := node.Dial(t, "alpha", "team", nil)
+	second := node.Dial(t, "alpha", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 1)
+
+	// A node subscribes once per user, however many connections it holds.
+	time.Sleep(50 * time.Millisecond)
+	if n := cluster.Backplane.NumSub(channel); n != 1 {
+		t.Fatalf("subscribers for %s = %d, want 1", channel, n)
+	}
+	first.Close()
+	node.WaitConnections(t, "alpha", 1)
+	time.Sleep(50 * time.Millisecond)
+	if n := cluster.Backplane.NumSub(channel); n != 1 {
+		t.Fatalf("subscribers after one close = %d, want 1", n)
+	}
+	second.Close()
+	waitFor(t, DefaultTimeout, func() bool {
+		return cluster.Backplane.NumSub(channel) == 0
+	}, "%s unsubscribed", channel)
+}
+
+func TestShardedPubSub(t *testing.T) {
+	cluster := NewShardedCluster(t, 2)
+	sender := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	peer := cluster.Node(1).Dial(t, "beta", "team", nil)
+
+	sender.Send(t, "hello")
+	sender.Expect(t, "hello")
+	peer.Expect(t, "hello")
+
+	// User channels are hash-tagged and reached with SPUBLISH.
+	cluster.WaitUserSubscribed(t, "beta", 1)
+	if channel := cluster.Node(0).Server.Hub().UserChannel("beta"); !strings.HasPrefix(channel, "ws:user:{s") {
+		t.Fatalf("sharded user channel = %q, want a hash tag", channel)
+	}
+	if resp := cluster.Node(0).Post(t, "/notify/redis", url.Values{"ids": {"beta"}, "message": {"direct"}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("notify status = %d", resp.StatusCode)
+	}
+	peer.Expect(t, "direct")
+	sender.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestDebugFramesCarryTheRoute(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	sender := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	local := cluster.Node(0).Dial(t, "beta", "team", url.Values{"debug": {"1"}})
+	remote := cluster.Node(1).Dial(t, "gamma", "team", url.Values{"debug": {"1"}})
+	plain := cluster.Node(1).Dial(t, "delta", "team", nil)
+
+	frame := `{"type":"chat","text":"hi"}`
+	sender.Send(t, frame)
+	sender.Expect(t, frame)
+	plain.Expect(t, frame)
+	for client, route := range map[*Client]string{local: "local", remote: "redis"} {
+		var got struct {
+			Type, Route, Source, Frame string
+		}
+		if err := json.Unmarshal(client.Next(t, DefaultTimeout), &got); err != nil {
+			t.Fatalf("debug frame: %v", err)
+		}
+		if got.Type != "debug" || got.Route != route || got.Source == "" || got.Frame != frame {
+			t.Fatalf("debug frame = %+v, want route %s wrapping %s", got, route, frame)
+		}
+	}
+}
+
+func TestNotifyRedisReportsDelivery(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	alpha := cluster.Node(1).Dial(t, "alpha", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 1)
+
+	resp := cluster.Node(0).Post(t, "/notify/redis", url.Values{"ids": {"alpha,ghost"}, "message": {"hi"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("notify status = %d", resp.StatusCode)
+	}
+	var sent struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sent); err != nil || sent.ID == "" {
+		t.Fatalf("notify response: id=%q err=%v", sent.ID, err)
+	}
+	alpha.Expect(t, "hi")
+
+	var status struct {
+		Users map[string]struct {
+			Status string `json:"status"`
+		} `json:"users"`
+	}
+	waitFor(t, DefaultTimeout, func() bool {
+		resp := cluster.Node(1).Get(t, "/v1/notifications/"+sent.ID)
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&status) != nil {
+			return false
+		}
+		return status.Users["alpha"].Status == "delivered"
+	}, "alpha delivery receipt")
+	if got := status.Users["ghost"].Status; got != "no_connection" {
+		t.Fatalf("ghost status = %q, want no_connection", got)
+	}
+}
+
+func TestReceiptsAggregateAcrossNodes(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	first := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	second := cluster.Node(1).Dial(t, "alpha", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 2)
+
+	resp := cluster.Node(0).Post(t, "/notify/redis", url.Values{"ids": {"alpha"}, "message": {"hi"}})
+	var sent struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sent); err != nil || sent.ID == "" {
+		t.Fatalf("notify response: id=%q err=%v", sent.ID, err)
+	}
+	first.Expect(t, "hi")
+	second.Expect(t, "hi")
+
+	var status ws.NotificationStatus
+	waitFor(t, DefaultTimeout, func() bool {
+		resp := cluster.Node(1).Get(t, "/v1/notifications/"+sent.ID)
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&status) != nil {
+			return false
+		}
+		return len(status.Users["alpha"].Nodes) == 2
+	}, "a report from both nodes")
+	alpha := status.Users["alpha"]
+	if alpha.Status != ws.DeliveryDelivered || alpha.Receivers != 2 {
+		t.Fatalf("alpha = %+v, want delivered to 2 receivers", alpha)
+	}
+	for node, report := range alpha.Nodes {
+		if report.Status != ws.DeliveryDelivered || report.Connections != 1 {
+			t.Fatalf("node %s report = %+v", node, report)
+		}
+	}
+
+	if resp := cluster.Node(0).Get(t, "/v1/notifications/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown notification status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestTopicPatternAcrossNodes(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	orders := cluster.Node(1).Dial(t, "alpha", "team", url.Values{"topics": {"orders.created"}})
+	billing := cluster.Node(1).Dial(t, "beta", "team", url.Values{"topics": {"billing.created"}})
+
+	cluster.Node(0).Post(t, "/notify/topic", url.Values{"pattern": {"orders.*"}, "message": {"order"}})
+
+	orders.Expect(t, "order")
+	billing.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestBroadcastAllAndGroupListAcrossNodes(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	red := cluster.Node(0).Dial(t, "alpha", "red", nil)
+	blue := cluster.Node(1).Dial(t, "beta", "blue", nil)
+	green := cluster.Node(1).Dial(t, "gamma", "green", nil)
+
+	cluster.Node(0).Post(t, "/notify/all", url.Values{"message": {"everyone"}})
+	for _, client := range []*Client{red, blue, green} {
+		client.Expect(t, "everyone")
+	}
+
+	cluster.Node(0).Post(t, "/notify/groups", url.Values{"groups": {"red,blue"}, "message": {"some"}})
+	red.Expect(t, "some")
+	blue.Expect(t, "some")
+	green.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestStalledClientIsDropped(t *testing.T) {
+	cluster := NewCluster(t, 1)
+	node := cluster.Node(0)
+	stalled := node.DialStalled(t, "slow", "team", nil)
+	defer stalled.Close()
+	sender := node.Dial(t, "fast", "team", nil)
+
+	// Large frames fill the socket buffers, then the 64-slot send queue.
+	payload := strings.Repeat("x", 64<<10)
+	for i := 0; i < 256; i++ {
+		sender.Send(t, payload)
+	}
+
+	node.WaitConnections(t, "slow", 0)
+}
+
+func TestProbesFailWhenDrainingOrBackplaneDown(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	probe := func(node *Node, path string) (int, map[string]struct {
+		Status string `json:"status"`
+	}) {
+		var body struct {
+			Checks map[string]struct {
+				Status string `json:"status"`
+			} `json:"checks"`
+		}
+		resp := node.Get(t, path)
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s body: %v", path, err)
+		}
+		return resp.StatusCode, body.Checks
+	}
+
+	for _, path := range []string{"/livez", "/readyz"} {
+		if code, _ := probe(cluster.Node(0), path); code != http.StatusOK {
+			t.Fatalf("%s = %d, want 200", path, code)
+		}
+	}
+
+	cluster.Node(0).Server.Drain()
+	code, checks := probe(cluster.Node(0), "/readyz")
+	if code != http.StatusServiceUnavailable || checks["draining"].Status != "fail" {
+		t.Fatalf("draining readyz = %d %+v", code, checks)
+	}
+	if code, _ := probe(cluster.Node(0), "/livez"); code != http.StatusOK {
+		t.Fatalf("draining livez = %d, want 200", code)
+	}
+
+	_ = cluster.Backplane.Close()
+	code, checks = probe(cluster.Node(1), "/readyz")
+	if code != http.StatusServiceUnavailable || checks["backplane"].Status != "fail" || checks["hub"].Status != "ok" {
+		t.Fatalf("backplane-down readyz = %d %+v", code, checks)
+	}
+
+	// A node whose backplane never came up fails liveness so it restarts.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve address: %v", err)
+	}
+	_ = listener.Close()
+	server := httpserver.New(httpserver.WithHubOptions(ws.WithRedisConfig(ws.RedisConfig{Mode: ws.RedisModeSingle, Addrs: []string{listener.Addr().String()}})))
+	defer server.Close()
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	code, checks = probe(&Node{Server: server, HTTP: ts, URL: ts.URL}, "/livez")
+	if code != http.StatusServiceUnavailable || checks["backplane_started"].Status != "fail" || checks["hub"].Status != "ok" {
+		t.Fatalf("never-connected livez = %d %+v", code, checks)
+	}
+}
+
+func TestEmbeddedUIDescribesNode(t *testing.T) {
+	cluster := NewCluster(t, 1, httpserver.WithUI())
+	node := cluster.Node(0)
+
+	resp := node.Get(t, "/ui/")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("/ui/ = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var config struct {
+		WSURL   string `json:"wsUrl"`
+		HTTPURL string `json:"httpUrl"`
+	}
+	resp = node.Get(t, "/ui/config.json")
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		t.Fatalf("config.json: %v", err)
+	}
+	if config.HTTPURL != node.URL || config.WSURL != "ws"+strings.TrimPrefix(node.URL, "http")+"/ws" {
+		t.Fatalf("config = %+v, want urls for %s", config, node.URL)
+	}
+}
+
+func TestHooksAndInterceptors(t *testing.T) {
+	events := make(chan string, 16)
+	opts := httpserver.WithHubOptions(
+		ws.OnConnect(func(c *ws.Client) { events <- "connect " + c.UserID() }),
+		ws.OnMessage(func(c *ws.Client, payload []byte) { events <- "message " + c.UserID() + " " + string(payload) }),
+		ws.OnDisconnect(func(c *ws.Client, reason ws.DisconnectReason) {
+			events <- "disconnect " + c.UserID() + " " + string(reason)
+		}),
+		ws.WithInterceptor(func(msg *ws.Message) error {
+			switch payload := string(msg.Payload); {
+			case payload == "secret":
+				return errors.New("no secrets")
+			case strings.HasPrefix(payload, "ops:"):
+				// Reroute to the ops group instead of the sender's group.
+				msg.Group = "ops"
+				msg.UserID = ""
+				msg.Payload = []byte(strings.ToUpper(strings.TrimPrefix(payload, "ops:")))
+			}
+			return nil
+		}),
+	)
+	cluster := NewCluster(t, 2, opts)
+	expectEvent := func(want string) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("event = %q, want %q", got, want)
+			}
+		case <-time.After(DefaultTimeout):
+			t.Fatalf("no %q event", want)
+		}
+	}
+
+	sender := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	expectEvent("connect alpha")
+	ops := cluster.Node(1).Dial(t, "omega", "ops", nil)
+	expectEvent("connect omega")
+
+	sender.Send(t, "secret")
+	expectEvent("message alpha secret")
+	sender.ExpectNone(t, 100*time.Millisecond)
+
+	sender.Send(t, "ops:deploy")
+	expectEvent("message alpha ops:deploy")
+	ops.Expect(t, "DEPLOY")
+	sender.ExpectNone(t, 100*time.Millisecond)
+
+	resp := cluster.Node(0).Post(t, "/notify/redis", url.Values{"ids": {"omega"}, "message": {"secret"}})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("rejected notify status = %d, want 403", resp.StatusCode)
+	}
+
+	sender.Close()
+	expectEvent("disconnect alpha closed")
+}
+
+func TestClientRPC(t *testing.T) {
+	opts := httpserver.WithHubOptions(
+		ws.WithRPCTimeout(100*time.Millisecond),
+		ws.WithRPC("whoami", func(ctx context.Context, call *ws.RPCCall) (any, error) {
+			return map[string]string{"id": call.Client.UserID(), "params": string(call.Params)}, nil
+		}),
+		ws.WithRPC("deny", func(context.Context, *ws.RPCCall) (any, error) {
+			return nil, &ws.RPCError{Code: "forbidden", Message: "not allowed"}
+		}),
+		ws.WithRPC("slow", func(ctx context.Context, _ *ws.RPCCall) (any, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+	)
+	cluster := NewCluster(t, 1, opts)
+	caller := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	peer := cluster.Node(0).Dial(t, "beta", "team", nil)
+
+	caller.Send(t, `{"type":"rpc","id":"1","method":"whoami","params":[1]}`)
+	caller.Expect(t, `{"type":"rpc_result","id":"1","result":{"id":"alpha","params":"[1]"}}`)
+
+	caller.Send(t, `{"type":"rpc","id":"2","method":"deny"}`)
+	caller.Expect(t, `{"type":"rpc_error","id":"2","error":{"code":"forbidden","message":"not allowed"}}`)
+
+	caller.Send(t, `{"type":"rpc","id":"3","method":"missing"}`)
+	caller.Expect(t, `{"type":"rpc_error","id":"3","error":{"code":"method_not_found","message":"unknown method missing"}}`)
+
+	caller.Send(t, `{"type":"rpc","id":"4","method":"slow"}`)
+	caller.Expect(t, `{"type":"rpc_error","id":"4","error":{"code":"timeout","message":"call exceeded 100ms"}}`)
+
+	// Replies go to the caller only; RPC frames are never broadcast.
+	peer.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestRPCSlotsHeldUntilHandlerReturns(t *testing.T) {
+	release := make(chan struct{})
+	opts := httpserver.WithHubOptions(
+		ws.WithRPCTimeout(50*time.Millisecond),
+		ws.WithRPC("stuck", func(context.Context, *ws.RPCCall) (any, error) {
+			<-release
+			return "done", nil
+		}),
+	)
+	cluster := NewCluster(t, 1, opts)
+	defer close(release)
+	caller := cluster.Node(0).Dial(t, "alpha", "team", nil)
+
+	// 32 is the per-connection in-flight limit; every call times out while
+	// its handler keeps running.
+	for i := 0; i < 32; i++ {
+		caller.Send(t, fmt.Sprintf(`{"type":"rpc","id":"%d","method":"stuck"}`, i))
+	}
+	for i := 0; i < 32; i++ {
+		if frame := string(caller.Next(t, DefaultTimeout)); !strings.Contains(frame, `"code":"timeout"`) {
+			t.Fatalf("reply %d = %s, want a timeout", i, frame)
+		}
+	}
+	caller.Send(t, `{"type":"rpc","id":"extra","method":"stuck"}`)
+	caller.Expect(t, `{"type":"rpc_error","id":"extra","error":{"code":"too_many_calls","message":"too many calls in flight"}}`)
+}
+
+func TestServerCallsUserAcrossNodes(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	callee := cluster.Node(1).Dial(t, "alpha", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 1)
+
+	call := func(body string) (int, string) {
+		resp, err := http.Post(cluster.Node(0).URL+"/v1/users/alpha/rpc", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Errorf("POST rpc: %v", err)
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		var out bytes.Buffer
+		_, _ = out.ReadFrom(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(out.String())
+	}
+	type response struct {
+		status int
+		body   string
+	}
+	answer := func(body string, reply func(id string) string) response {
+		done := make(chan response, 1)
+		go func() {
+			status, out := call(body)
+			done <- response{status, out}
+		}()
+		var frame struct {
+			Type, ID, Method string
+			Params           json.RawMessage
+		}
+		if err := json.Unmarshal(callee.Next(t, DefaultTimeout), &frame); err != nil || frame.Type != "rpc_call" || frame.Method != "confirm" {
+			t.Fatalf("call frame = %+v (%v)", frame, err)
+		}
+		if string(frame.Params) != `{"action":"delete"}` {
+			t.Fatalf("params = %s", frame.Params)
+		}
+		if msg := reply(frame.ID); msg != "" {
+			callee.Send(t, msg)
+		}
+		return <-done
+	}
+
+	got := answer(`{"method":"confirm","params":{"action":"delete"}}`, func(id string) string {
+		return `{"type":"rpc_reply","id":"` + id + `","result":{"ok":true}}`
+	})
+	if got.status != http.StatusOK || got.body != `{"id":"alpha","result":{"ok":true}}` {
+		t.Fatalf("result = %d %s", got.status, got.body)
+	}
+
+	got = answer(`{"method":"confirm","params":{"action":"delete"}}`, func(id string) string {
+		return `{"type":"rpc_reply","id":"` + id + `","error":{"code":"denied","message":"user said no"}}`
+	})
+	if got.status != http.StatusBadGateway || got.body != `{"error":{"code":"denied","message":"user said no"}}` {
+		t.Fatalf("client error = %d %s", got.status, got.body)
+	}
+
+	got = answer(`{"method":"confirm","params":{"action":"delete"},"timeout_ms":100}`, func(string) string { return "" })
+	if got.status != http.StatusGatewayTimeout {
+		t.Fatalf("unanswered call = %d %s", got.status, got.body)
+	}
+
+	callee.Close()
+	cluster.Node(1).WaitConnections(t, "alpha", 0)
+	waitFor(t, DefaultTimeout, func() bool {
+		status, _ := call(`{"method":"confirm"}`)
+		return status == http.StatusNotFound
+	}, "call to disconnected user to fail")
+}
+
+func TestGroupPolicies(t *testing.T) {
+	// Each node gets its own ACL, as with GROUP_ACL_FILE on separate hosts.
+	perNodeACL := func(h *ws.Hub) {
+		acl, err := ws.NewACL(map[string]ws.GroupPolicy{
+			"ops":  {Join: []string{"alpha", "beta"}, Publish: []string{"alpha"}, MaxMembers: 2},
+			"news": {ReadOnly: true},
+		})
+		if err != nil {
+			t.Fatalf("acl: %v", err)
+		}
+		ws.WithACL(acl)(h)
+	}
+	cluster := NewCluster(t, 2, httpserver.WithHubOptions(perNodeACL))
+	node := cluster.Node(0)
+
+	if status := dialStatus(t, node, "mallory", "ops"); status != http.StatusForbidden {
+		t.Fatalf("outsider join status = %d, want 403", status)
+	}
+
+	// max_members counts connections on every node.
+	alpha := node.Dial(t, "alpha", "ops", nil)
+	beta := cluster.Node(1).Dial(t, "beta", "ops", nil)
+	for _, n := range []*Node{node, cluster.Node(1)} {
+		if status := dialStatus(t, n, "alpha", "ops"); status != http.StatusServiceUnavailable {
+			t.Fatalf("join past max_members status = %d, want 503", status)
+		}
+	}
+
+	alpha.Send(t, "deploy")
+	alpha.Expect(t, "deploy")
+	beta.Expect(t, "deploy")
+	beta.Send(t, "rollback")
+	beta.Expect(t, `{"type":"error","error":{"code":"publish_denied","message":"publish denied: beta may not publish to ops"}}`)
+	alpha.ExpectNone(t, 100*time.Millisecond)
+
+	reader := node.Dial(t, "gamma", "news", nil)
+	reader.Send(t, "hi")
+	reader.Expect(t, `{"type":"error","error":{"code":"publish_denied","message":"publish denied: news is read-only"}}`)
+
+	// The admin API stores policies on every node, ahead of configuration,
+	// and applies them from the next frame.
+	editACL := func(n *Node, method, body string) int {
+		req, _ := http.NewRequest(method, n.URL+"/v1/groups/news/acl", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s acl: %v", method, err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	// waitPolicy blocks until node 0 has synced the stored policy.
+	waitPolicy := func(want ws.GroupPolicy) {
+		waitFor(t, DefaultTimeout, func() bool {
+			var got struct {
+				Policy ws.GroupPolicy `json:"policy"`
+			}
+			resp := node.Get(t, "/v1/groups/news/acl")
+			return json.NewDecoder(resp.Body).Decode(&got) == nil && reflect.DeepEqual(got.Policy, want)
+		}, "node 0 to sync news policy %+v", want)
+	}
+	if status := editACL(cluster.Node(1), http.MethodPut, `{"max_members":5}`); status != http.StatusOK {
+		t.Fatalf("PUT acl status = %d", status)
+	}
+	waitPolicy(ws.GroupPolicy{MaxMembers: 5})
+	reader.Send(t, "hi")
+	reader.Expect(t, "hi")
+
+	if status := editACL(cluster.Node(1), http.MethodPut, `{"read_only":true,"max_members":5}`); status != http.StatusOK {
+		t.Fatalf("PUT acl status = %d", status)
+	}
+	waitPolicy(ws.GroupPolicy{ReadOnly: true, MaxMembers: 5})
+	reader.Send(t, "hi")
+	reader.Expect(t, `{"type":"error","error":{"code":"publish_denied","message":"publish denied: news is read-only"}}`)
+
+	// Clearing the stored policy falls back to node 0's configured one.
+	if status := editACL(cluster.Node(1), http.MethodDelete, ""); status != http.StatusOK {
+		t.Fatalf("DELETE acl status = %d", status)
+	}
+	if status := editACL(cluster.Node(1), http.MethodDelete, ""); status != http.StatusNotFound {
+		t.Fatalf("second DELETE acl status = %d, want 404", status)
+	}
+	waitPolicy(ws.GroupPolicy{ReadOnly: true})
+	if status := editACL(node, http.MethodPut, `{"max_members":-1}`); status != http.StatusBadRequest {
+		t.Fatalf("invalid policy status = %d, want 400", status)
+	}
+}
+
+// dialStatus attempts a websocket handshake and returns the HTTP status,
+// 101 when the upgrade succeeded.
+func dialStatus(t *testing.T, node *Node, id, group string) int {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(node.WSURL(url.Values{"id": {id}, "group": {group}}), nil)
+	if err == nil {
+		_ = conn.Close()
+		return http.StatusSwitchingProtocols
+	}
+	if resp == nil {
+		t.Fatalf("dial %s: %v", id, err)
+	}
+	return resp.StatusCode
+}
+
+func TestConnectionLimits(t *testing.T) {
+	reasons := make(chan ws.DisconnectReason, 8)
+	cluster := NewCluster(t, 2, httpserver.WithHubOptions(
+		ws.WithLimits(ws.Limits{ClusterPerUser: 1, PerIP: 3, Node: 2, Policy: ws.LimitEvictOldest}),
+		ws.OnDisconnect(func(c *ws.Client, reason ws.DisconnectReason) {
+			if c.UserID() == "alpha" {
+				reasons <- reason
+			}
+		}),
+	))
+
+	// A second connection for alpha on another node evicts the first.
+	first := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	cluster.WaitUserSubscribed(t, "alpha", 1)
+	second := cluster.Node(1).Dial(t, "alpha", "team", nil)
+	first.ExpectClosed(t, DefaultTimeout)
+	select {
+	case reason := <-reasons:
+		if reason != ws.DisconnectEvicted {
+			t.Fatalf("disconnect reason = %s, want evicted", reason)
+		}
+	case <-time.After(DefaultTimeout):
+		t.Fatal("no disconnect for evicted connection")
+	}
+	cluster.Node(0).WaitConnections(t, "alpha", 0)
+	second.Send(t, "still here")
+	second.Expect(t, "still here")
+
+	// A request that passes the limits but fails the handshake evicts no one.
+	if resp := cluster.Node(0).Get(t, "/ws?id=alpha&group=team"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET on /ws = %d, want 400", resp.StatusCode)
+	}
+	select {
+	case reason := <-reasons:
+		t.Fatalf("failed handshake disconnected alpha: %s", reason)
+	case <-time.After(200 * time.Millisecond):
+	}
+	second.Send(t, "after failed handshake")
+	second.Expect(t, "after failed handshake")
+
+	// Node 1 is full at two connections: readiness fails and joins are refused.
+	cluster.Node(1).Dial(t, "beta", "team", nil)
+	if resp := cluster.Node(1).Get(t, "/readyz"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("full node readyz = %d, want 503", resp.StatusCode)
+	}
+	if status := dialStatus(t, cluster.Node(1), "gamma", "team"); status != http.StatusServiceUnavailable {
+		t.Fatalf("join on full node = %d, want 503", status)
+	}
+
+	// Under reject, the address limit refuses instead of evicting.
+	strict := NewCluster(t, 1, httpserver.WithHubOptions(ws.WithLimits(ws.Limits{PerIP: 1, Policy: ws.LimitReject})))
+	kept := strict.Node(0).Dial(t, "delta", "team", nil)
+	if status := dialStatus(t, strict.Node(0), "epsilon", "team"); status != http.StatusTooManyRequests {
+		t.Fatalf("join past ip limit = %d, want 429", status)
+	}
+	kept.Send(t, "ok")
+	kept.Expect(t, "ok")
+
+	// Behind a proxy only the hop it appended counts; a forged leading
+	// X-Forwarded-For entry does not get a fresh address.
+	proxied := NewCluster(t, 1, httpserver.WithHubOptions(ws.WithLimits(ws.Limits{PerIP: 1, Policy: ws.LimitReject, TrustProxy: true})))
+	dialVia := func(id, forwarded string) (*websocket.Conn, int) {
+		header := http.Header{"X-Forwarded-For": {forwarded}}
+		conn, resp, err := websocket.DefaultDialer.Dial(proxied.Node(0).WSURL(url.Values{"id": {id}, "group": {"team"}}), header)
+		if err == nil {
+			t.Cleanup(func() { _ = conn.Close() })
+			return conn, http.StatusSwitchingProtocols
+		}
+		if resp == nil {
+			t.Fatalf("dial %s: %v", id, err)
+		}
+		return nil, resp.StatusCode
+	}
+	if _, status := dialVia("zeta", "203.0.113.7"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("first proxied join = %d, want 101", status)
+	}
+	proxied.Node(0).WaitConnections(t, "zeta", 1)
+	if _, status := dialVia("eta", "198.51.100.1, 203.0.113.7"); status != http.StatusTooManyRequests {
+		t.Fatalf("join with spoofed forwarded-for = %d, want 429", status)
+	}
+	if _, status := dialVia("theta", "203.0.113.8"); status != http.StatusSwitchingProtocols {
+		t.Fatalf("join from another address = %d, want 101", status)
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	chat, err := schema.Compile([]byte(`{
+		"type": "object",
+		"required": ["text"],
+		"properties": {"text": {"type": "string", "minLength": 1}}
+	}`))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cluster := NewCluster(t, 2, httpserver.WithHubOptions(ws.WithSchemas(map[string]*schema.Schema{"chat": chat})))
+	sender := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	peer := cluster.Node(1).Dial(t, "beta", "team", nil)
+
+	sender.Send(t, `{"type":"chat","id":"m1","text":""}`)
+	sender.Expect(t, `{"type":"error","ref":"m1","error":{"code":"invalid_message","message":"frame does not match the chat schema","details":[{"path":"/text","message":"must be at least 1 characters"}]}}`)
+	peer.ExpectNone(t, 100*time.Millisecond)
+
+	// Malformed JSON and non-string types are rejected too.
+	sender.Send(t, `{"type":"chat","text":`)
+	sender.Expect(t, `{"type":"error","error":{"code":"invalid_message","message":"frame is not valid JSON"}}`)
+	sender.Send(t, `{"type":7,"id":"m2","text":"hi"}`)
+	sender.Expect(t, `{"type":"error","ref":"m2","error":{"code":"invalid_message","message":"frame \"type\" must be a string"}}`)
+	peer.ExpectNone(t, 100*time.Millisecond)
+
+	// Valid frames, untyped frames and types without a schema are broadcast.
+	for _, frame := range []string{`{"type":"chat","text":"hi"}`, "plain", `{"type":"presence"}`} {
+		sender.Send(t, frame)
+		peer.Expect(t, frame)
+	}
+}
+
+func TestPersistedGroups(t *testing.T) {
+	cluster := NewCluster(t, 2)
+	send := func(node *Node, method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, node.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var out bytes.Buffer
+		_, _ = out.ReadFrom(resp.Body)
+		return resp.StatusCode, out.String()
+	}
+
+	status, body := send(cluster.Node(0), http.MethodPost, "/v1/groups",
+		`{"id":"ops","name":"Operations","owner":"alpha","settings":{"topic":"incidents"},"members":["alpha"],"policy":{"max_members":5}}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create = %d %s", status, body)
+	}
+	if status, _ := send(cluster.Node(1), http.MethodPost, "/v1/groups", `{"id":"ops"}`); status != http.StatusConflict {
+		t.Fatalf("duplicate create = %d, want 409", status)
+	}
+
+	// Both nodes read the same record and enforce its membership.
+	var group ws.Group
+	status, body = send(cluster.Node(1), http.MethodGet, "/v1/groups/ops", "")
+	if err := json.Unmarshal([]byte(body), &group); err != nil || status != http.StatusOK {
+		t.Fatalf("get = %d %s", status, body)
+	}
+	if group.Name != "Operations" || group.Owner != "alpha" || group.Settings["topic"] != "incidents" || group.CreatedAt.IsZero() {
+		t.Fatalf("group = %+v", group)
+	}
+	waitFor(t, DefaultTimeout, func() bool {
+		return dialStatus(t, cluster.Node(1), "beta", "ops") == http.StatusForbidden
+	}, "node 1 to enforce group membership")
+	cluster.Node(1).Dial(t, "alpha", "ops", nil)
+
+	if status, body := send(cluster.Node(0), http.MethodPut, "/v1/groups/ops/members/beta", ""); status != http.StatusOK {
+		t.Fatalf("add member = %d %s", status, body)
+	}
+	waitFor(t, DefaultTimeout, func() bool {
+		return dialStatus(t, cluster.Node(1), "beta", "ops") == http.StatusSwitchingProtocols
+	}, "node 1 to admit the new member")
+
+	// Concurrent adds through both nodes must not overwrite each other.
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/v1/groups/ops/members/user%d", cluster.Node(i%2).URL, i), nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("add user%d: %v", i, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("add user%d = %d", i, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	_, body = send(cluster.Node(0), http.MethodGet, "/v1/groups/ops", "")
+	if err := json.Unmarshal([]byte(body), &group); err != nil || len(group.Members) != 10 {
+		t.Fatalf("members after concurrent adds = %v, want 10", group.Members)
+	}
+
+	if status, _ := send(cluster.Node(1), http.MethodDelete, "/v1/groups/ops", ""); status != http.StatusOK {
+		t.Fatalf("delete = %d", status)
+	}
+	if status, _ := send(cluster.Node(0), http.MethodGet, "/v1/groups/ops", ""); status != http.StatusNotFound {
+		t.Fatalf("get deleted = %d, want 404", status)
+	}
+	waitFor(t, DefaultTimeout, func() bool {
+		return dialStatus(t, cluster.Node(0), "gamma", "ops") == http.StatusSwitchingProtocols
+	}, "deleted group to stop restricting joins")
+	if status, _ := send(cluster.Node(0), http.MethodPost, "/v1/groups", `{"id":"bad id"}`); status != http.StatusBadRequest {
+		t.Fatalf("invalid id = %d, want 400", status)
+	}
+}
+
+func TestEphemeralState(t *testing.T) {
+	cluster := NewCluster(t, 2, httpserver.WithHubOptions(ws.WithStateTiming(100*time.Millisecond, 300*time.Millisecond)))
+	typist := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	peer := cluster.Node(1).Dial(t, "beta", "team", nil)
+
+	// A burst of updates is coalesced into at most a couple of frames that
+	// end with the latest value.
+	for i := 1; i <= 20; i++ {
+		typist.Send(t, fmt.Sprintf(`{"type":"state","key":"typing","value":%d}`, i))
+	}
+	last := `{"type":"state","group":"team","states":[{"user":"alpha","key":"typing","value":20,"ttl_ms":300}]}`
+	frames := 0
+	for got := ""; got != last; frames++ {
+		if frames == 2 {
+			t.Fatalf("burst not coalesced, last frame %q", got)
+		}
+		got = string(peer.Next(t, DefaultTimeout))
+	}
+
+	// Keys expire without further updates.
+	peer.Expect(t, `{"type":"state","group":"team","states":[{"user":"alpha","key":"typing","value":null,"expired":true}]}`)
+
+	// Keys are cleared when their owner disconnects, and never replayed.
+	typist.Send(t, `{"type":"state","key":"cursor","value":{"line":3},"ttl_ms":10000}`)
+	peer.Expect(t, `{"type":"state","group":"team","states":[{"user":"alpha","key":"cursor","value":{"line":3},"ttl_ms":10000}]}`)
+	typist.Close()
+	peer.Expect(t, `{"type":"state","group":"team","states":[{"user":"alpha","key":"cursor","value":null}]}`)
+	late := cluster.Node(0).Dial(t, "gamma", "team", nil)
+	late.ExpectNone(t, 300*time.Millisecond)
+}
+
+func TestGroupMessageHistory(t *testing.T) {
+	cluster := NewCluster(t, 2, httpserver.WithHubOptions(ws.WithHistory(5)))
+	alpha := cluster.Node(0).Dial(t, "alpha", "team", nil)
+	beta := cluster.Node(1).Dial(t, "beta", "team", nil)
+	stored := func() int {
+		messages, err := cluster.Node(1).Server.Hub().GroupMessages(context.Background(), "team", "", ws.MaxHistoryPage)
+		if err != nil {
+			t.Fatalf("history: %v", err)
+		}
+		return len(messages)
+	}
+
+	// Messages are stored once by their origin node, wherever they are sent.
+	for i := 1; i <= 7; i++ {
+		sender := alpha
+		if i%2 == 0 {
+			sender = beta
+		}
+		sender.Send(t, fmt.Sprintf("m%d", i))
+		alpha.Expect(t, fmt.Sprintf("m%d", i))
+		beta.Expect(t, fmt.Sprintf("m%d", i))
+		want := min(i, 5)
+		waitFor(t, DefaultTimeout, func() bool { return stored() == want }, "%d stored messages", want)
+	}
+	// Ephemeral state is never stored.
+	alpha.Send(t, `{"type":"state","key":"typing","value":true}`)
+	beta.Next(t, DefaultTimeout)
+
+	type page struct {
+		Count      int                 `json:"count"`
+		Messages   []ws.HistoryMessage `json:"messages"`
+		NextBefore string              `json:"next_before"`
+	}
+	get := func(query string) (int, page) {
+		resp, err := http.Get(cluster.Node(0).URL + "/v1/groups/team/messages" + query)
+		if err != nil {
+			t.Fatalf("get history: %v", err)
+		}
+		defer resp.Body.Close()
+		var out page
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	// Pages run newest first; only the newest five are kept.
+	var contents []string
+	cursor := ""
+	for {
+		status, got := get("?limit=2&before=" + cursor)
+		if status != http.StatusOK {
+			t.Fatalf("history status = %d", status)
+		}
+		for _, msg := range got.Messages {
+			contents = append(contents, msg.Sender+":"+msg.Content)
+		}
+		if got.NextBefore == "" {
+			break
+		}
+		cursor = got.NextBefore
+	}
+	want := "alpha:m7 beta:m6 alpha:m5 beta:m4 alpha:m3"
+	if got := strings.Join(contents, " "); got != want {
+		t.Fatalf("history = %q, want %q", got, want)
+	}
+
+	if status, _ := get("?before=nope"); status != http.StatusBadRequest {
+		t.Fatalf("bad cursor status = %d, want 400", status)
+	}
+	if status, _ := get("?limit=0"); status != http.StatusBadRequest {
+		t.Fatalf("bad limit status = %d, want 400", status)
+	}
+
+	// The unversioned path serves the same history.
+	resp := cluster.Node(1).Get(t, "/groups/team/messages?limit=1")
+	var latest page
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unversioned history = %d, %v", resp.StatusCode, err)
+	}
+	if latest.Count != 1 || latest.Messages[0].Content != "m7" {
+		t.Fatalf("unversioned history = %+v, want m7", latest)
+	}
+}
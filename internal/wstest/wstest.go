@@ -0,0 +1,151 @@
+// Package wstest runs several hub nodes in-process for multi-node tests.
+//
+// A Cluster starts N httpserver.Server instances on random ports, all
+// sharing one in-memory Redis stand-in, so cross-node fan-out, per-user
+// channels and stalled clients can be exercised with plain go test.
+package wstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-playground/internal/httpserver"
+	"go-playground/internal/memredis"
+	"go-playground/internal/ws"
+)
+
+// DefaultTimeout bounds every wait in the helpers unless a test passes its own.
+const DefaultTimeout = 2 * time.Second
+
+// Cluster is a set of nodes sharing one backplane.
+type Cluster struct {
+	Backplane *memredis.Server
+	Nodes     []*Node
+}
+
+// Node is one running server.
+type Node struct {
+	Server *httpserver.Server
+	HTTP   *httptest.Server
+	URL    string
+}
+
+// NewCluster starts n nodes and stops them when the test ends. Extra
+// server options are applied to every node.
+func NewCluster(t testing.TB, n int, opts ...httpserver.Option) *Cluster {
+	t.Helper()
+	return newCluster(t, n, false, opts)
+}
+
+// NewShardedCluster is NewCluster with the nodes in Redis cluster mode using
+// sharded pub/sub; the stand-in answers as a single-node cluster.
+func NewShardedCluster(t testing.TB, n int, opts ...httpserver.Option) *Cluster {
+	t.Helper()
+	return newCluster(t, n, true, opts)
+}
+
+func newCluster(t testing.TB, n int, sharded bool, opts []httpserver.Option) *Cluster {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	backplane := memredis.New()
+	if err := backplane.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("start backplane: %v", err)
+	}
+	cluster := &Cluster{Backplane: backplane}
+	t.Cleanup(cluster.Close)
+
+	cfg := ws.RedisConfig{
+		Mode:    ws.RedisModeSingle,
+		Addrs:   []string{backplane.Addr()},
+		Channel: "ws:broadcast",
+	}
+	if sharded {
+		cfg.Mode, cfg.Sharded = ws.RedisModeCluster, true
+	}
+	for i := 0; i < n; i++ {
+		nodeOpts := append([]httpserver.Option{httpserver.WithHubOptions(ws.WithRedisConfig(cfg))}, opts...)
+		server := httpserver.New(nodeOpts...)
+		ts := httptest.NewServer(server.Handler())
+		cluster.Nodes = append(cluster.Nodes, &Node{Server: server, HTTP: ts, URL: ts.URL})
+	}
+	return cluster
+}
+
+// Node returns the i-th node.
+func (c *Cluster) Node(i int) *Node {
+	return c.Nodes[i]
+}
+
+// Close stops every node and the backplane.
+func (c *Cluster) Close() {
+	for _, node := range c.Nodes {
+		node.HTTP.Close()
+		node.Server.Close()
+	}
+	_ = c.Backplane.Close()
+}
+
+// WaitUserSubscribed blocks until nodes backplane subscriptions exist for the
+// user, which is when per-user Redis notifications can reach them.
+func (c *Cluster) WaitUserSubscribed(t testing.TB, userID string, nodes int) {
+	t.Helper()
+	channel := c.Node(0).Server.Hub().UserChannel(userID)
+	waitFor(t, DefaultTimeout, func() bool {
+		return c.Backplane.NumSub(channel) >= nodes
+	}, "user %s subscribed on %d nodes", userID, nodes)
+}
+
+// WSURL builds the /ws URL for this node with the given query.
+func (n *Node) WSURL(query url.Values) string {
+	return "ws" + strings.TrimPrefix(n.URL, "http") + "/ws?" + query.Encode()
+}
+
+// Post sends a POST with query parameters and returns the response.
+func (n *Node) Post(t testing.TB, path string, query url.Values) *http.Response {
+	t.Helper()
+	resp, err := http.Post(n.URL+path+"?"+query.Encode(), "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// Get sends a GET and returns the response.
+func (n *Node) Get(t testing.TB, path string) *http.Response {
+	t.Helper()
+	resp, err := http.Get(n.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t testing.TB, timeout time.Duration, cond func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for "+format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitConnections blocks until the node holds want connections for the user.
+func (n *Node) WaitConnections(t testing.TB, userID string, want int) {
+	t.Helper()
+	hub := n.Server.Hub()
+	waitFor(t, DefaultTimeout, func() bool {
+		return hub.UserConnections(userID) == want
+	}, "%d connections for %s", want, userID)
+}
@@ -0,0 +1,3 @@
+#!/usr/bin/env fish
+# Stop and remove the app nodes, leaving redis and web running.
+docker compose -f docker/docker-compose.yml rm -s -f app
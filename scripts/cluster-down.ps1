@@ -0,0 +1,2 @@
+# Stop and remove the app nodes, leaving redis and web running.
+docker compose -f docker/docker-compose.yml rm -s -f app
@@ -0,0 +1,3 @@
+#!/usr/bin/env fish
+# Build and run redis and 1 app node(s).
+docker compose -f docker/docker-compose.yml up --build -d redis app
@@ -18,7 +18,10 @@
   ];
 
   // Fixed ports to simulate multiple backend nodes locally.
-  const nodePorts = [8080, 8081];
+  let nodePorts = [8080, 8081];
+  // Overridden by config.json when the UI is served by a node at /ui.
+  let defaultHost = 'localhost';
+  let secure = false;
   // Persist session configuration across reloads using localStorage.
   const storageKey = 'wsSessions';
   const controlKey = 'wsControls';
@@ -78,6 +81,23 @@
     localStorage.setItem(controlKey, JSON.stringify(controls));
   }
 
+  // Debug connections get each hub frame wrapped with its route; unwrap it
+  // so the log shows the original frame and labels the ones relayed by Redis.
+  function describeFrame(data) {
+    try {
+      const wrapped = JSON.parse(data);
+      if (wrapped && wrapped.type === 'debug' && typeof wrapped.frame === 'string') {
+        return {
+          title: wrapped.route === 'redis' ? 'Received [redis] from ' + wrapped.source : 'Received',
+          body: wrapped.frame,
+        };
+      }
+    } catch (err) {
+      // Plain text frames are logged as they are.
+    }
+    return { title: 'Received', body: data };
+  }
+
   // Log a message entry with styling for sent, received, or system events.
   function logEntry(logEl, kind, title, body) {
     const entry = document.createElement('div');
@@ -122,15 +142,11 @@
       '<div class="row">' +
       '<label class="field">' +
       '<span>Host</span>' +
-      '<input class="ws-host" type="text" value="localhost">' +
+      '<input class="ws-host" type="text">' +
       '</label>' +
       '<label class="field">' +
       '<span>Node</span>' +
-      '<select class="node-port">' +
-      nodePorts
-        .map((port, idx) => '<option value="' + port + '">Node ' + (idx + 1) + ' : ' + port + '</option>')
-        .join('') +
-      '</select>' +
+      '<select class="node-port"></select>' +
       '</label>' +
       '</div>' +
       '<div class="row">' +
@@ -184,6 +200,8 @@
     if (group) {
       params.push('group=' + encodeURIComponent(group));
     }
+    // Ask the hub to wrap frames with their route so the log can label them.
+    params.push('debug=1');
     if (!params.length) {
       return url;
     }
@@ -191,7 +209,7 @@
   }
 
   function buildWsUrl(host, port) {
-    return 'ws://' + host + ':' + port + '/ws';
+    return (secure ? 'wss://' : 'ws://') + host + ':' + port + '/ws';
   }
 
   // Attach websocket behavior to a session card.
@@ -227,6 +245,15 @@
       presetBar.appendChild(btn);
     });
 
+    // Server-provided values go through the DOM, never into markup.
+    hostInput.value = defaultHost;
+    nodePorts.forEach((port, idx) => {
+      const option = document.createElement('option');
+      option.value = String(port);
+      option.textContent = 'Node ' + (idx + 1) + ' : ' + port;
+      nodeSelect.appendChild(option);
+    });
+
     const portOptions = nodePorts.map((port) => String(port));
     if (sessionData.host) {
       hostInput.value = sessionData.host;
@@ -283,7 +310,8 @@
       socket.addEventListener('message', (event) => {
         recvCount += 1;
         recvCountEl.textContent = String(recvCount);
-        logEntry(logEl, 'received', 'Received', String(event.data));
+        const frame = describeFrame(String(event.data));
+        logEntry(logEl, 'received', frame.title, frame.body);
       });
 
       socket.addEventListener('close', () => {
@@ -366,7 +394,7 @@
     }
     const message = notifyMessageInput.value.trim() || 'notification';
     const url =
-      'http://' +
+      (secure ? 'https://' : 'http://') +
       node.host +
       ':' +
       node.port +
@@ -389,7 +417,7 @@
     }
     const message = redisMessageInput.value.trim() || 'redis notification';
     const url =
-      'http://' +
+      (secure ? 'https://' : 'http://') +
       node.host +
       ':' +
       node.port +
@@ -457,13 +485,32 @@
     }
   }
 
-  const storedSessions = loadSessions();
-  if (storedSessions.length) {
-    storedSessions.forEach((session) => {
-      sessionsEl.appendChild(createSessionCard(session));
-    });
-  } else {
-    sessionsEl.appendChild(createSessionCard());
+  // A node serving the UI describes itself; the nginx build has no config.
+  function loadServerConfig() {
+    return fetch('config.json')
+      .then((res) => (res.ok ? res.json() : null))
+      .then((config) => {
+        if (!config) {
+          return;
+        }
+        defaultHost = config.host || defaultHost;
+        secure = Boolean(config.secure);
+        if (config.port) {
+          nodePorts = [config.port].concat(nodePorts.filter((port) => port !== config.port));
+        }
+      })
+      .catch(() => {});
   }
-  updateSessionCount();
+
+  loadServerConfig().then(() => {
+    const storedSessions = loadSessions();
+    if (storedSessions.length) {
+      storedSessions.forEach((session) => {
+        sessionsEl.appendChild(createSessionCard(session));
+      });
+    } else {
+      sessionsEl.appendChild(createSessionCard());
+    }
+    updateSessionCount();
+  });
 })();
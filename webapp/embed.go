@@ -0,0 +1,10 @@
+// Package webapp embeds the browser test UI so a node can serve it itself.
+// The HTML, CSS and JS are generated by gen-assets; only this file is not.
+package webapp
+
+import "embed"
+
+// Files holds the UI served at /ui.
+//
+//go:embed index.html styles.css app.js
+var Files embed.FS